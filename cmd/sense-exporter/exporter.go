@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnesting/sense/realtime"
+)
+
+// exporter keeps the latest real-time data for each monitor and serves it
+// in the Prometheus text exposition format.
+type exporter struct {
+	mu       sync.Mutex
+	monitors map[int]*monitorState
+}
+
+type monitorState struct {
+	accountID  int
+	connected  bool
+	reconnects int
+	updated    time.Time
+	update     *realtime.RealtimeUpdate // nil if we have no current data
+}
+
+func newExporter() *exporter {
+	return &exporter{monitors: make(map[int]*monitorState)}
+}
+
+// addMonitor registers a monitor, so that it is reported even before any
+// data arrives.
+func (e *exporter) addMonitor(accountID, monitorID int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.monitors[monitorID]; !ok {
+		e.monitors[monitorID] = &monitorState{accountID: accountID}
+	}
+}
+
+// handle is a sense.MonitorCallback that records messages from monitorID.
+func (e *exporter) handle(_ context.Context, monitorID int, msg realtime.Message) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.monitors[monitorID]
+	if !ok {
+		m = &monitorState{}
+		e.monitors[monitorID] = m
+	}
+	switch msg := msg.(type) {
+	case *realtime.Hello:
+		m.connected = true
+	case *realtime.Reconnected:
+		m.connected = true
+		m.reconnects++
+	case *realtime.Disconnected:
+		// Don't report stale data.
+		m.connected = false
+		m.update = nil
+	case *realtime.RealtimeUpdate:
+		m.connected = true
+		m.update = msg
+		m.updated = time.Now()
+	}
+	return nil
+}
+
+// deviceType returns the type of a device, using the same tags that
+// sense.Device.Type is derived from.
+func deviceType(d realtime.Device) string {
+	for _, tag := range []string{"UserDeviceType", "Type", "DefaultUserDeviceType"} {
+		if s, ok := d.Tags[tag].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// metrics describes the metrics we export, in the order they are written.
+var metrics = []struct {
+	name, typ, help string
+}{
+	{"sense_up", "gauge", "Whether the real-time connection to the monitor is up."},
+	{"sense_reconnects_total", "counter", "Number of times the real-time connection was re-established."},
+	{"sense_last_update_timestamp_seconds", "gauge", "When the last real-time update was received."},
+	{"sense_power_watts", "gauge", "Total power consumption observed by the monitor."},
+	{"sense_grid_power_watts", "gauge", "Power drawn from the grid."},
+	{"sense_frequency_hertz", "gauge", "AC line frequency."},
+	{"sense_channel_power_watts", "gauge", "Power observed on each channel."},
+	{"sense_channel_voltage_volts", "gauge", "Voltage observed on each channel."},
+	{"sense_device_power_watts", "gauge", "Power consumed by each detected device."},
+}
+
+// samples collects formatted samples by metric name.
+type samples map[string][]string
+
+// add formats a sample.  labels are name/value pairs.
+func (s samples) add(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	s[name] = append(s[name], b.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteTo writes the current metrics to w in the Prometheus text format.
+func (e *exporter) WriteTo(w io.Writer) (int64, error) {
+	s := make(samples)
+	e.mu.Lock()
+	ids := make([]int, 0, len(e.monitors))
+	for id := range e.monitors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		e.monitors[id].collect(s, id)
+	}
+	e.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		if len(s[m.name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, line := range s[m.name] {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// collect adds the samples for this monitor to s.
+func (m *monitorState) collect(s samples, monitorID int) {
+	monitor := []string{"account", strconv.Itoa(m.accountID), "monitor", strconv.Itoa(monitorID)}
+	with := func(labels ...string) []string {
+		return append(append([]string(nil), monitor...), labels...)
+	}
+
+	up := 0.0
+	if m.connected {
+		up = 1
+	}
+	s.add("sense_up", up, monitor...)
+	s.add("sense_reconnects_total", float64(m.reconnects), monitor...)
+
+	u := m.update
+	if u == nil {
+		return
+	}
+	s.add("sense_last_update_timestamp_seconds", float64(m.updated.UnixMilli())/1000, monitor...)
+	s.add("sense_power_watts", float64(u.W), monitor...)
+	s.add("sense_grid_power_watts", float64(u.GridW), monitor...)
+	s.add("sense_frequency_hertz", float64(u.Hz), monitor...)
+	for i, w := range u.Channels {
+		s.add("sense_channel_power_watts", float64(w), with("channel", strconv.Itoa(i))...)
+	}
+	for i, v := range u.Voltage {
+		s.add("sense_channel_voltage_volts", float64(v), with("channel", strconv.Itoa(i))...)
+	}
+	devices := append([]realtime.Device(nil), u.Devices...)
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	for _, d := range devices {
+		s.add("sense_device_power_watts", float64(d.W), with(
+			"device_id", d.ID,
+			"device_name", d.Name,
+			"device_type", deviceType(d))...)
+	}
+}
+
+// ServeHTTP serves the metrics.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/realtime"
+	"github.com/dnesting/sense/sensetest"
+)
+
+func TestExporter(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{
+			ID: 123,
+			Realtime: []realtime.Message{
+				&realtime.Hello{Online: true},
+				&realtime.RealtimeUpdate{
+					W:        590.5,
+					GridW:    400,
+					Hz:       60,
+					Channels: []float32{300, 290.5},
+					Voltage:  []float32{120.5, 121},
+					Devices: []realtime.Device{
+						{ID: "b", Name: `Fridge "Big"`, W: 150, Tags: map[string]interface{}{"UserDeviceType": "Fridge"}},
+						{ID: "a", Name: "Always On", W: 80},
+					},
+				},
+			},
+			CloseRealtime: true,
+		}, {
+			ID: 456,
+		}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := newExporter()
+	for _, m := range client.GetMonitors() {
+		exp.addMonitor(client.GetAccountID(), m.ID)
+	}
+	acct := client.GetAccountID()
+	err = client.Stream(ctx, 123, func(ctx context.Context, msg realtime.Message) error {
+		exp.handle(ctx, 123, msg)
+		if _, ok := msg.(*realtime.RealtimeUpdate); ok {
+			return realtime.Stop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	exp.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	got := string(body)
+	a := "account=\"" + strconv.Itoa(acct) + "\","
+	for _, want := range []string{
+		"# TYPE sense_up gauge\n",
+		"sense_up{" + a + "monitor=\"123\"} 1\n",
+		"sense_up{" + a + "monitor=\"456\"} 0\n",
+		"sense_power_watts{" + a + "monitor=\"123\"} 590.5\n",
+		"sense_grid_power_watts{" + a + "monitor=\"123\"} 400\n",
+		"sense_frequency_hertz{" + a + "monitor=\"123\"} 60\n",
+		"sense_channel_power_watts{" + a + "monitor=\"123\",channel=\"1\"} 290.5\n",
+		"sense_channel_voltage_volts{" + a + "monitor=\"123\",channel=\"0\"} 120.5\n",
+		"sense_device_power_watts{" + a + "monitor=\"123\",device_id=\"a\",device_name=\"Always On\",device_type=\"\"} 80\n" +
+			"sense_device_power_watts{" + a + "monitor=\"123\",device_id=\"b\",device_name=\"Fridge \\\"Big\\\"\",device_type=\"Fridge\"} 150\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `sense_power_watts{`+a+`monitor="456"}`) {
+		t.Errorf("expected no data for monitor 456, got:\n%s", got)
+	}
+
+	// Data shouldn't be reported while disconnected.
+	exp.handle(ctx, 123, &realtime.Disconnected{})
+	rec = httptest.NewRecorder()
+	exp.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got = rec.Body.String()
+	if strings.Contains(got, "sense_power_watts") || !strings.Contains(got, "sense_up{"+a+"monitor=\"123\"} 0\n") {
+		t.Errorf("expected monitor 123 to be down with no data, got:\n%s", got)
+	}
+}
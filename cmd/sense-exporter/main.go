@@ -0,0 +1,91 @@
+// Command sense-exporter streams real-time data from Sense monitors and
+// serves it as Prometheus metrics.
+//
+// Credentials are configured with the usual flags, environment variables,
+// or configuration file (see the sensecli package), which can name several
+// accounts.  Every monitor in each account is streamed, reconnecting
+// whenever the connection fails.  Metrics are served on /metrics:
+//
+//	sense-exporter --sense-config=sense.yaml --listen=:9553
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/realtime"
+	"github.com/dnesting/sense/sensecli"
+)
+
+var (
+	flagListen      = flag.String("listen", ":9553", "address to serve metrics on")
+	flagIdleTimeout = flag.Duration("idle-timeout", 30*time.Second, "reconnect if no data arrives for this long")
+	flagDebug       = flag.Bool("debug", false, "enable debug logging")
+	// note: other flags set by sensecli.SetupStandardFlags()
+)
+
+func main() {
+	configFile, flagCreds := sensecli.SetupStandardFlags()
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := []sense.Option{
+		sense.WithReconnect(realtime.DefaultBackoff),
+		sense.WithIdleTimeout(*flagIdleTimeout),
+		sense.WithRetry(sense.DefaultRetryPolicy),
+	}
+	if *flagDebug {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		opts = append(opts, sense.WithLogger(logger))
+	}
+	clients, err := sensecli.CreateClients(ctx, configFile, flagCreds, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exp := newExporter()
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		monitors := client.GetMonitors()
+		if len(monitors) == 0 {
+			log.Printf("account %d: no monitors", client.GetAccountID())
+			continue
+		}
+		for _, m := range monitors {
+			exp.addMonitor(client.GetAccountID(), m.ID)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// With WithReconnect, this only returns once ctx is done.
+			if err := client.StreamAll(ctx, exp.handle); err != nil {
+				log.Printf("account %d: %v", client.GetAccountID(), err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	srv := &http.Server{Addr: *flagListen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("serving metrics on %s/metrics", *flagListen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	wg.Wait()
+}
@@ -1,30 +1,48 @@
 package sense
 
 import (
-	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
-	"strings"
+	"sync/atomic"
 
+	"github.com/dnesting/sense/internal/redact"
 	"github.com/dnesting/sense/internal/senseutil"
 	"github.com/dnesting/sense/realtime"
 	"github.com/dnesting/sense/senseauth"
 )
 
-var debugLogger *log.Logger
+var debugLogger atomic.Pointer[slog.Logger]
 
-type loggingTransport struct {
-	transport http.RoundTripper
-}
+// discardLogger is used when no logger has been provided, so the library
+// stays quiet unless asked otherwise.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
 
-func debug(args ...interface{}) {
-	if debugLogger != nil {
-		debugLogger.Output(2, strings.TrimRight(fmt.Sprint(args...), "\n"))
+// logger returns l, or if that is nil, the logger set with SetDebug,
+// or a logger that discards everything.
+func logger(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	if l := debugLogger.Load(); l != nil {
+		return l
 	}
+	return discardLogger
+}
+
+// log returns the logger for this client.
+func (s *Client) log() *slog.Logger {
+	return logger(s.opt.logger)
+}
+
+type loggingTransport struct {
+	transport http.RoundTripper
+	log       *log.Logger
 }
 
 func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	senseutil.DumpRequest(debugLogger, r)
+	senseutil.DumpRequest(s.log, r)
 
 	tr := s.transport
 	if tr == nil {
@@ -32,24 +50,39 @@ func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	}
 	resp, err := tr.RoundTrip(r)
 	if err != nil {
-		debug("error:", err)
+		s.log.Println("error:", redact.String(err.Error()))
 		return nil, err
 	}
-	senseutil.DumpResponse(debugLogger, resp)
+	senseutil.DumpResponse(s.log, resp)
 	return resp, err
 }
 
 // SetDebug enables debug logging using the given logger and returns an
 // [*http.Client] that wraps baseClient, logging requests and responses
 // to the same logger.  Passing nil will disable debug logging.
+//
+// Debug logs go to l only for clients without their own logger; see
+// [WithLogger].
 func SetDebug(l *log.Logger, baseClient *http.Client) *http.Client {
 	if baseClient == nil {
 		baseClient = http.DefaultClient
 	}
-	debugLogger = l
 	senseauth.SetDebug(l)
 	realtime.SetDebug(l)
+	if l == nil {
+		debugLogger.Store(nil)
+		return baseClient
+	}
+	debugLogger.Store(slog.New(slog.NewTextHandler(l.Writer(), &slog.HandlerOptions{Level: slog.LevelDebug})))
 	return &http.Client{
-		Transport: &loggingTransport{baseClient.Transport},
+		Transport: &loggingTransport{baseClient.Transport, l},
 	}
 }
+
+// SetDebugRedaction controls whether passwords, MFA codes, and tokens are
+// redacted from debug logs, including the request and response dumps
+// enabled by [SetDebug].  Redaction is enabled by default, and should only
+// be disabled for local troubleshooting.
+func SetDebugRedaction(enabled bool) {
+	redact.SetEnabled(enabled)
+}
@@ -41,7 +41,7 @@ func stringOrEmpty(v interface{}) string {
 
 // GetDevices returns a list of devices known to the given monitor.
 func (s *Client) GetDevices(ctx context.Context, monitorID int, includeMerged bool) (devs []Device, err error) {
-	res, err1 := s.client.GetDevicesWithResponse(
+	res, err1 := s.current().client.GetDevicesWithResponse(
 		ctx,
 		monitorID,
 		&client.GetDevicesParams{
@@ -27,7 +27,7 @@ func (e environments) Get(id string) *environment {
 
 // getEnvironments returns a list of environments from the Sense API.
 func (s *Client) getEnvironments(ctx context.Context) (envs environments, err error) {
-	res, err1 := s.client.GetEnvironmentsWithResponse(ctx)
+	res, err1 := s.current().client.GetEnvironmentsWithResponse(ctx)
 	if err := client.Ensure(err1, "getEnvironments", res, 200); err != nil {
 		return nil, err
 	}
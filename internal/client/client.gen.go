@@ -1,9 +1,10 @@
 // Package client provides primitives to interact with the openapi HTTP API.
 //
-// Code generated by github.com/oapi-codegen/oapi-codegen/v2 version v2.3.0 DO NOT EDIT.
+// Code generated by github.com/oapi-codegen/oapi-codegen/v2 version v2.4.1 DO NOT EDIT.
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -73,7 +74,7 @@ type Monitor struct {
 type MonitorAttributes struct {
 	BasementType        *string      `json:"basement_type,omitempty"`
 	BasementTypeKey     *interface{} `json:"basement_type_key,omitempty"`
-	Cost                *float32     `json:"cost,omitempty"`
+	Cost                *float64     `json:"cost,omitempty"`
 	CycleStart          *interface{} `json:"cycle_start,omitempty"`
 	ElectricityCost     *interface{} `json:"electricity_cost,omitempty"`
 	HomeSizeType        *string      `json:"home_size_type,omitempty"`
@@ -88,7 +89,7 @@ type MonitorAttributes struct {
 	Panel               *interface{} `json:"panel,omitempty"`
 	PostalCode          *string      `json:"postal_code,omitempty"`
 	PowerRegion         *string      `json:"power_region,omitempty"`
-	SellBackRate        *float32     `json:"sell_back_rate,omitempty"`
+	SellBackRate        *float64     `json:"sell_back_rate,omitempty"`
 	ShowCost            *bool        `json:"show_cost,omitempty"`
 	SolarTouEnabled     *bool        `json:"solar_tou_enabled,omitempty"`
 	State               *interface{} `json:"state,omitempty"`
@@ -153,12 +154,20 @@ type RenewAuthTokenFormdataBody struct {
 	UserId        *int    `form:"user_id,omitempty" json:"user_id,omitempty"`
 }
 
+// UpdateNotificationSettingsParams defines parameters for UpdateNotificationSettings.
+type UpdateNotificationSettingsParams struct {
+	MonitorId int `form:"monitor_id" json:"monitor_id"`
+}
+
 // AuthenticateFormdataRequestBody defines body for Authenticate for application/x-www-form-urlencoded ContentType.
 type AuthenticateFormdataRequestBody AuthenticateFormdataBody
 
 // RenewAuthTokenFormdataRequestBody defines body for RenewAuthToken for application/x-www-form-urlencoded ContentType.
 type RenewAuthTokenFormdataRequestBody RenewAuthTokenFormdataBody
 
+// UpdateNotificationSettingsJSONRequestBody defines body for UpdateNotificationSettings for application/json ContentType.
+type UpdateNotificationSettingsJSONRequestBody = NotificationSettings
+
 // RequestEditorFn  is the function signature for the RequestEditor callback function
 type RequestEditorFn func(ctx context.Context, req *http.Request) error
 
@@ -240,6 +249,9 @@ type ClientInterface interface {
 
 	AuthenticateWithFormdataBody(ctx context.Context, body AuthenticateFormdataRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
 
+	// Logout request
+	Logout(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// GetEnvironments request
 	GetEnvironments(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
 
@@ -247,6 +259,14 @@ type ClientInterface interface {
 	RenewAuthTokenWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
 
 	RenewAuthTokenWithFormdataBody(ctx context.Context, body RenewAuthTokenFormdataRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetUser request
+	GetUser(ctx context.Context, userId int, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// UpdateNotificationSettingsWithBody request with any body
+	UpdateNotificationSettingsWithBody(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	UpdateNotificationSettings(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, body UpdateNotificationSettingsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
 }
 
 func (c *Client) GetDevices(ctx context.Context, monitorId int, params *GetDevicesParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
@@ -285,6 +305,18 @@ func (c *Client) AuthenticateWithFormdataBody(ctx context.Context, body Authenti
 	return c.Client.Do(req)
 }
 
+func (c *Client) Logout(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewLogoutRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) GetEnvironments(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
 	req, err := NewGetEnvironmentsRequest(c.Server)
 	if err != nil {
@@ -321,6 +353,42 @@ func (c *Client) RenewAuthTokenWithFormdataBody(ctx context.Context, body RenewA
 	return c.Client.Do(req)
 }
 
+func (c *Client) GetUser(ctx context.Context, userId int, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetUserRequest(c.Server, userId)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) UpdateNotificationSettingsWithBody(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewUpdateNotificationSettingsRequestWithBody(c.Server, userId, params, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) UpdateNotificationSettings(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, body UpdateNotificationSettingsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewUpdateNotificationSettingsRequest(c.Server, userId, params, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
 // NewGetDevicesRequest generates requests for GetDevices
 func NewGetDevicesRequest(server string, monitorId int, params *GetDevicesParams) (*http.Request, error) {
 	var err error
@@ -417,6 +485,33 @@ func NewAuthenticateRequestWithBody(server string, contentType string, body io.R
 	return req, nil
 }
 
+// NewLogoutRequest generates requests for Logout
+func NewLogoutRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/logout")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewGetEnvironmentsRequest generates requests for GetEnvironments
 func NewGetEnvironmentsRequest(server string) (*http.Request, error) {
 	var err error
@@ -484,6 +579,105 @@ func NewRenewAuthTokenRequestWithBody(server string, contentType string, body io
 	return req, nil
 }
 
+// NewGetUserRequest generates requests for GetUser
+func NewGetUserRequest(server string, userId int) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "user_id", runtime.ParamLocationPath, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/users/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewUpdateNotificationSettingsRequest calls the generic UpdateNotificationSettings builder with application/json body
+func NewUpdateNotificationSettingsRequest(server string, userId int, params *UpdateNotificationSettingsParams, body UpdateNotificationSettingsJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewUpdateNotificationSettingsRequestWithBody(server, userId, params, "application/json", bodyReader)
+}
+
+// NewUpdateNotificationSettingsRequestWithBody generates requests for UpdateNotificationSettings with any type of body
+func NewUpdateNotificationSettingsRequestWithBody(server string, userId int, params *UpdateNotificationSettingsParams, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "user_id", runtime.ParamLocationPath, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/users/%s/notifications", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "monitor_id", runtime.ParamLocationQuery, params.MonitorId); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("PUT", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
 func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
 	for _, r := range c.RequestEditors {
 		if err := r(ctx, req); err != nil {
@@ -535,6 +729,9 @@ type ClientWithResponsesInterface interface {
 
 	AuthenticateWithFormdataBodyWithResponse(ctx context.Context, body AuthenticateFormdataRequestBody, reqEditors ...RequestEditorFn) (*AuthenticateResponse, error)
 
+	// LogoutWithResponse request
+	LogoutWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*LogoutResponse, error)
+
 	// GetEnvironmentsWithResponse request
 	GetEnvironmentsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetEnvironmentsResponse, error)
 
@@ -542,6 +739,14 @@ type ClientWithResponsesInterface interface {
 	RenewAuthTokenWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*RenewAuthTokenResponse, error)
 
 	RenewAuthTokenWithFormdataBodyWithResponse(ctx context.Context, body RenewAuthTokenFormdataRequestBody, reqEditors ...RequestEditorFn) (*RenewAuthTokenResponse, error)
+
+	// GetUserWithResponse request
+	GetUserWithResponse(ctx context.Context, userId int, reqEditors ...RequestEditorFn) (*GetUserResponse, error)
+
+	// UpdateNotificationSettingsWithBodyWithResponse request with any body
+	UpdateNotificationSettingsWithBodyWithResponse(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*UpdateNotificationSettingsResponse, error)
+
+	UpdateNotificationSettingsWithResponse(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, body UpdateNotificationSettingsJSONRequestBody, reqEditors ...RequestEditorFn) (*UpdateNotificationSettingsResponse, error)
 }
 
 type GetDevicesResponse struct {
@@ -597,6 +802,28 @@ func (r AuthenticateResponse) StatusCode() int {
 	return 0
 }
 
+type LogoutResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSONDefault  *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r LogoutResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r LogoutResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 type GetEnvironmentsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
@@ -652,6 +879,52 @@ func (r RenewAuthTokenResponse) StatusCode() int {
 	return 0
 }
 
+type GetUserResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Hello
+	JSONDefault  *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetUserResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetUserResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type UpdateNotificationSettingsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *UserSettings
+	JSONDefault  *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r UpdateNotificationSettingsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r UpdateNotificationSettingsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 // GetDevicesWithResponse request returning *GetDevicesResponse
 func (c *ClientWithResponses) GetDevicesWithResponse(ctx context.Context, monitorId int, params *GetDevicesParams, reqEditors ...RequestEditorFn) (*GetDevicesResponse, error) {
 	rsp, err := c.GetDevices(ctx, monitorId, params, reqEditors...)
@@ -678,6 +951,15 @@ func (c *ClientWithResponses) AuthenticateWithFormdataBodyWithResponse(ctx conte
 	return ParseAuthenticateResponse(rsp)
 }
 
+// LogoutWithResponse request returning *LogoutResponse
+func (c *ClientWithResponses) LogoutWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*LogoutResponse, error) {
+	rsp, err := c.Logout(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLogoutResponse(rsp)
+}
+
 // GetEnvironmentsWithResponse request returning *GetEnvironmentsResponse
 func (c *ClientWithResponses) GetEnvironmentsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetEnvironmentsResponse, error) {
 	rsp, err := c.GetEnvironments(ctx, reqEditors...)
@@ -704,6 +986,32 @@ func (c *ClientWithResponses) RenewAuthTokenWithFormdataBodyWithResponse(ctx con
 	return ParseRenewAuthTokenResponse(rsp)
 }
 
+// GetUserWithResponse request returning *GetUserResponse
+func (c *ClientWithResponses) GetUserWithResponse(ctx context.Context, userId int, reqEditors ...RequestEditorFn) (*GetUserResponse, error) {
+	rsp, err := c.GetUser(ctx, userId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetUserResponse(rsp)
+}
+
+// UpdateNotificationSettingsWithBodyWithResponse request with arbitrary body returning *UpdateNotificationSettingsResponse
+func (c *ClientWithResponses) UpdateNotificationSettingsWithBodyWithResponse(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*UpdateNotificationSettingsResponse, error) {
+	rsp, err := c.UpdateNotificationSettingsWithBody(ctx, userId, params, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseUpdateNotificationSettingsResponse(rsp)
+}
+
+func (c *ClientWithResponses) UpdateNotificationSettingsWithResponse(ctx context.Context, userId int, params *UpdateNotificationSettingsParams, body UpdateNotificationSettingsJSONRequestBody, reqEditors ...RequestEditorFn) (*UpdateNotificationSettingsResponse, error) {
+	rsp, err := c.UpdateNotificationSettings(ctx, userId, params, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseUpdateNotificationSettingsResponse(rsp)
+}
+
 // ParseGetDevicesResponse parses an HTTP response from a GetDevicesWithResponse call
 func ParseGetDevicesResponse(rsp *http.Response) (*GetDevicesResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -777,6 +1085,32 @@ func ParseAuthenticateResponse(rsp *http.Response) (*AuthenticateResponse, error
 	return response, nil
 }
 
+// ParseLogoutResponse parses an HTTP response from a LogoutWithResponse call
+func ParseLogoutResponse(rsp *http.Response) (*LogoutResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &LogoutResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && true:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSONDefault = &dest
+
+	}
+
+	return response, nil
+}
+
 // ParseGetEnvironmentsResponse parses an HTTP response from a GetEnvironmentsWithResponse call
 func ParseGetEnvironmentsResponse(rsp *http.Response) (*GetEnvironmentsResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -851,3 +1185,69 @@ func ParseRenewAuthTokenResponse(rsp *http.Response) (*RenewAuthTokenResponse, e
 
 	return response, nil
 }
+
+// ParseGetUserResponse parses an HTTP response from a GetUserWithResponse call
+func ParseGetUserResponse(rsp *http.Response) (*GetUserResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetUserResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Hello
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && true:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSONDefault = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseUpdateNotificationSettingsResponse parses an HTTP response from a UpdateNotificationSettingsWithResponse call
+func ParseUpdateNotificationSettingsResponse(rsp *http.Response) (*UpdateNotificationSettingsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &UpdateNotificationSettingsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest UserSettings
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && true:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSONDefault = &dest
+
+	}
+
+	return response, nil
+}
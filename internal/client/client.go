@@ -1,9 +1,14 @@
 package client
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // The bulk of the client implementation is generated from the OpenAPI spec
@@ -11,45 +16,6 @@ import (
 
 //go:generate oapi-codegen --config=oapi-codegen.config openapi.yaml
 
-// AsErr is a helper that returns nil only if parent is nil and withErrorReason
-// does not have a value in its ErrorReason field.  Otherwise, it returns an
-// error derived from both of these values as appropriate.
-//
-// This is useful since JSON APIs have multiple ways they can return errors,
-// and this function helps normalize them all behind an error type.
-func AsErr(parent error, withErrorReason interface{}) (err error) {
-	err = parent
-	if withErrorReason == nil {
-		return err
-	}
-
-	// Try to extract an error message from the provided value.  Multiple
-	// structs may have an ErrorReason field, so we use reflect to find it.
-	v := reflect.ValueOf(withErrorReason)
-	// Dereference if needed
-	if v.Kind() == reflect.Interface {
-		v = v.Elem()
-	}
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	field := v.FieldByName("ErrorReason")
-	if field.IsValid() && !field.IsNil() {
-		if field.Kind() == reflect.Ptr {
-			field = field.Elem()
-		}
-		if val, ok := field.Interface().(string); ok {
-			err = errors.New(val)
-			if parent != nil {
-				err = fmt.Errorf("%w: %w", parent, err)
-			}
-		}
-	}
-
-	return err
-}
-
 type statusCoder interface {
 	Status() string
 	StatusCode() int
@@ -59,6 +25,10 @@ type statusCoder interface {
 // You can test it using errors.Is(err, client.ErrAuthenticationNeeded).
 var ErrAuthenticationNeeded = errors.New("authentication needed")
 
+// Ensure returns parent (prefixed with op) if the response has the expected
+// status code, and otherwise an [*APIError] describing the response, wrapping
+// parent if it is non-nil.
+//
 // For reference, a typical Response struct in the generated API client for a call
 // that specifies 200 and 401 are valid responses normally looks like this:
 //
@@ -73,61 +43,119 @@ var ErrAuthenticationNeeded = errors.New("authentication needed")
 //		}
 //		JSONDefault *Error
 //	}
-func Ensure(parent error, prepend string, response statusCoder, code int) error {
-	if parent != nil && prepend != "" {
-		parent = fmt.Errorf("%s: %w", prepend, parent)
-	}
-	if response == nil {
+func Ensure(parent error, op string, response statusCoder, code int) error {
+	v := reflect.ValueOf(response)
+	if response == nil || (v.Kind() == reflect.Ptr && v.IsNil()) {
 		// we can't do any better than parent, so just return it
-		return AsErr(parent, nil)
+		return prepend(op, parent)
 	}
-	v := reflect.ValueOf(response)
-	if v.Kind() == reflect.Interface {
-		v = v.Elem()
+	if response.StatusCode() == code {
+		// this means success, but don't ignore the error we were passed
+		return prepend(op, parent)
+	}
+
+	apiErr := &APIError{
+		Op:         op,
+		StatusCode: response.StatusCode(),
+		Status:     response.Status(),
 	}
-	if v.Kind() == reflect.Ptr {
-		if v.IsNil() {
-			// response pointed to nil, so, like above, we can't do any better
-			return AsErr(parent, nil)
+	v = reflect.Indirect(v)
+	if f := v.FieldByName("Body"); f.IsValid() {
+		apiErr.Body, _ = f.Interface().([]byte)
+	}
+	if f := v.FieldByName("HTTPResponse"); f.IsValid() {
+		if res, _ := f.Interface().(*http.Response); res != nil {
+			apiErr.RetryAfter = ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
 		}
-		v = v.Elem()
 	}
 
-	if response.StatusCode() == code {
-		// this means success, but don't ignore the error we were passed
-		return parent
+	// Errors all seem to use a body like Error, even when the spec doesn't
+	// say so, so don't bother looking for JSONDefault and friends.
+	var body Error
+	if json.Unmarshal(apiErr.Body, &body) == nil {
+		apiErr.ServerStatus = deref(body.Status)
+		apiErr.Reason = deref(body.ErrorReason)
 	}
 
-	// Special treatment for 401 responses, which seem to also use an *Error body.
-	if response.StatusCode() == 401 {
-		if parent == nil {
-			parent = ErrAuthenticationNeeded
-		} else {
-			parent = fmt.Errorf("%w: %w", parent, ErrAuthenticationNeeded)
-		}
-		field := v.FieldByName("JSON401")
-		if field.IsValid() && !field.IsNil() {
-			if val, ok := field.Interface().(*Error); ok {
-				return AsErr(parent, val)
-			}
-		}
+	if parent != nil {
+		return fmt.Errorf("%w: %w", apiErr, parent)
+	}
+	return apiErr
+}
+
+func prepend(op string, err error) error {
+	if err != nil && op != "" {
+		return fmt.Errorf("%s: %w", op, err)
 	}
+	return err
+}
+
+func deref[T any](v *T) (r T) {
+	if v != nil {
+		r = *v
+	}
+	return
+}
 
-	if parent == nil {
-		parent = errors.New(response.Status())
-	} else {
-		parent = fmt.Errorf("%w: %s", parent, response.Status())
+// APIError is returned when the Sense API responds with an unexpected status
+// code.  Use errors.As to retrieve it.  An APIError for a 401 response also
+// matches [ErrAuthenticationNeeded] with errors.Is.
+type APIError struct {
+	Op         string // the API operation, like "GetDevices"
+	StatusCode int    // the HTTP status code, like 404
+	Status     string // the HTTP status, like "404 Not Found"
+
+	// ServerStatus and Reason are the "status" and "error_reason" fields
+	// from the response body, if present.
+	ServerStatus string
+	Reason       string
+
+	// RetryAfter is how long the server asked us to wait before retrying,
+	// or 0 if it didn't say.
+	RetryAfter time.Duration
+
+	// Body is the raw response body.
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Op != "" {
+		b.WriteString(e.Op)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Status)
+	if e.Reason != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Reason)
+	} else if e.StatusCode == http.StatusUnauthorized {
+		b.WriteString(": ")
+		b.WriteString(ErrAuthenticationNeeded.Error())
 	}
+	return b.String()
+}
+
+// Is reports whether target is ErrAuthenticationNeeded and this is a 401.
+func (e *APIError) Is(target error) bool {
+	return target == ErrAuthenticationNeeded && e.StatusCode == http.StatusUnauthorized
+}
 
-	// Code isn't what we expected, it's not a 401, and there's no JSON{code} field.
-	// Return an error derived from the JSONDefault field if it is available.
-	field := v.FieldByName("JSONDefault")
-	if field.IsValid() && !field.IsNil() {
-		if val, ok := field.Interface().(*Error); ok {
-			return AsErr(parent, val)
+// ParseRetryAfter parses a Retry-After header, which is either a number
+// of seconds or an HTTP date.  It returns 0 if v is empty or invalid.
+func ParseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
 		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
 	}
-	return AsErr(parent, nil)
+	return 0
 }
 
 // AuthPayloadKey is something we use to smuggle the auth response payload out via the auth token.
@@ -0,0 +1,70 @@
+// Package redact removes secrets such as passwords and tokens from text
+// destined for debug logs.
+package redact
+
+import (
+	"regexp"
+	"sync/atomic"
+)
+
+// Replacement is substituted for redacted values.
+const Replacement = "REDACTED"
+
+var disabled atomic.Bool
+
+// SetEnabled controls whether String redacts anything.  Redaction is
+// enabled by default.
+func SetEnabled(enabled bool) {
+	disabled.Store(!enabled)
+}
+
+// Enabled reports whether redaction is enabled.
+func Enabled() bool {
+	return !disabled.Load()
+}
+
+// secretFields are the names of form fields, query parameters, and JSON
+// fields whose values are secret.
+const secretFields = `password|totp|mfa_token|access_token|refresh_token`
+
+var patterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Authorization: Bearer xyz
+	{regexp.MustCompile(`(?im)^(authorization:[ \t]*(?:\w+[ \t]+)?)\S+`), "${1}" + Replacement},
+	// password=xyz&... in form bodies and query strings
+	{regexp.MustCompile(`(?i)\b(` + secretFields + `)=[^&\s"]*`), "${1}=" + Replacement},
+	// "password": "xyz" in JSON bodies
+	{regexp.MustCompile(`(?i)"(` + secretFields + `)"(\s*:\s*)"(?:[^"\\]|\\.)*"`), `"${1}"${2}"` + Replacement + `"`},
+}
+
+// String returns s with any secrets replaced with [Replacement], unless
+// redaction has been disabled.  This recognizes Authorization headers and
+// passwords, MFA codes, and tokens in form bodies, query strings, and JSON.
+func String(s string) string {
+	if !Enabled() {
+		return s
+	}
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Error wraps err so that its message is passed through [String].  The
+// original error remains available to [errors.Is] and [errors.As].  If err
+// is nil, Error returns nil.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err}
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string { return String(e.err.Error()) }
+func (e *redactedError) Unwrap() error { return e.err }
@@ -27,7 +27,17 @@ type MockRTClient struct {
 }
 
 func (c *MockRTClient) Stream(ctx context.Context, deviceID int, f realtime.Callback) error {
-	for msg := range c.Ch {
+	for {
+		var msg RTMsg
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok = <-c.Ch:
+		}
+		if !ok {
+			return nil
+		}
 		if msg.E != nil {
 			return msg.E
 		}
@@ -38,7 +48,6 @@ func (c *MockRTClient) Stream(ctx context.Context, deviceID int, f realtime.Call
 			return err
 		}
 	}
-	return nil
 }
 
 type WSMsg struct {
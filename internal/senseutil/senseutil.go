@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"strings"
+
+	"github.com/dnesting/sense/internal/redact"
 )
 
 func PrefixLines(prefix string, lines string) string {
 	return prefix + strings.ReplaceAll(strings.TrimSpace(lines), "\n", "\n"+prefix)
 }
 
+// DumpRequest logs r, including its body, with secrets redacted.
 func DumpRequest(log *log.Logger, r *http.Request) {
 	if log == nil {
 		return
@@ -19,11 +22,12 @@ func DumpRequest(log *log.Logger, r *http.Request) {
 	if err != nil {
 		log.Println("error dumping request:", err)
 	} else {
-		log.Println("HTTP request:\n" + PrefixLines("> ", string(bytes)))
+		log.Println("HTTP request:\n" + PrefixLines("> ", redact.String(string(bytes))))
 		log.Println()
 	}
 }
 
+// DumpResponse logs r, including its body, with secrets redacted.
 func DumpResponse(log *log.Logger, r *http.Response) {
 	wantBody := true
 	if r.StatusCode < http.StatusOK {
@@ -33,7 +37,7 @@ func DumpResponse(log *log.Logger, r *http.Response) {
 	if err != nil {
 		log.Println("error dumping response:", err)
 	} else {
-		log.Println("HTTP response:\n" + PrefixLines("> ", string(bytes)))
+		log.Println("HTTP response:\n" + PrefixLines("> ", redact.String(string(bytes))))
 		log.Println()
 	}
 }
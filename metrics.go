@@ -0,0 +1,107 @@
+package sense
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// metrics holds the OpenTelemetry instruments for this package.  They are
+// created using the global MeterProvider, which forwards to whatever
+// provider is later installed with otel.SetMeterProvider.
+var metrics struct {
+	requests        metric.Int64Counter
+	requestDuration metric.Float64Histogram
+}
+
+func init() {
+	meter := otel.Meter(traceName)
+	var errs [2]error
+	metrics.requests, errs[0] = meter.Int64Counter("sense.requests",
+		metric.WithDescription("Requests made to the Sense API, by operation and status"),
+		metric.WithUnit("{request}"))
+	metrics.requestDuration, errs[1] = meter.Float64Histogram("sense.request.duration",
+		metric.WithDescription("Latency of requests made to the Sense API, by operation and status"),
+		metric.WithUnit("s"))
+	if err := errors.Join(errs[:]...); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// addInstrumentation returns a client that wraps base, recording metrics
+// for each request and logging a summary of it at debug level.  Paths are
+// reported relative to apiUrl.
+func addInstrumentation(base *http.Client, apiUrl string, log *slog.Logger) *http.Client {
+	var prefix string
+	if u, err := url.Parse(apiUrl); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/")
+	}
+	return &http.Client{
+		Transport: &instrumentedHttpTransport{
+			log:    log,
+			prefix: prefix,
+			base:   base,
+		},
+	}
+}
+
+type instrumentedHttpTransport struct {
+	log    *slog.Logger // nil to use the default
+	prefix string
+	base   *http.Client
+}
+
+var idPattern = regexp.MustCompile(`/[0-9]+(/|$)`)
+
+// operation returns a name for the API operation in req that doesn't
+// include IDs, like "GET /app/monitors/{id}/devices/overview".
+func (t *instrumentedHttpTransport) operation(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, t.prefix)
+	// Replace twice, since adjacent IDs share a slash.
+	path = idPattern.ReplaceAllString(path, "/{id}$1")
+	path = idPattern.ReplaceAllString(path, "/{id}$1")
+	return req.Method + " " + path
+}
+
+func (t *instrumentedHttpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+	res, err := t.base.Do(req)
+	elapsed := time.Since(start)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	op := t.operation(req)
+	attrs := metric.WithAttributes(
+		attribute.String("operation", op),
+		attribute.String("status", status))
+	metrics.requests.Add(ctx, 1, attrs)
+	metrics.requestDuration.Record(ctx, elapsed.Seconds(), attrs)
+
+	log := logger(t.log)
+	if log.Enabled(ctx, slog.LevelDebug) {
+		logAttrs := []slog.Attr{
+			slog.String("operation", op),
+			slog.String("path", req.URL.Path),
+			slog.Duration("elapsed", elapsed),
+		}
+		if err != nil {
+			logAttrs = append(logAttrs, slog.Any("error", err))
+		} else {
+			logAttrs = append(logAttrs, slog.Int("status", res.StatusCode))
+		}
+		log.LogAttrs(ctx, slog.LevelDebug, "sense: request", logAttrs...)
+	}
+	return res, err
+}
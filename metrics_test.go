@@ -0,0 +1,151 @@
+package sense_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dnesting/sense/realtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// fakeMeterProvider records the values reported to its instruments, keyed
+// by instrument name and attributes, like "sense.monitor.power{monitor.id=123}".
+// Counters are summed, histograms count observations, and gauges hold the
+// last value.
+type fakeMeterProvider struct {
+	noop.MeterProvider
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (p *fakeMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return &fakeMeter{p: p}
+}
+
+func (p *fakeMeterProvider) get(key string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.values[key]
+}
+
+func (p *fakeMeterProvider) update(name string, attrs attribute.Set, fn func(float64) float64) {
+	key := name
+	if attrs.Len() > 0 {
+		key += "{" + attrs.Encoded(attribute.DefaultEncoder()) + "}"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[key] = fn(p.values[key])
+}
+
+type fakeMeter struct {
+	noop.Meter
+	p *fakeMeterProvider
+}
+
+func (m *fakeMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &fakeInt64Counter{p: m.p, name: name}, nil
+}
+
+func (m *fakeMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &fakeFloat64Histogram{p: m.p, name: name}, nil
+}
+
+func (m *fakeMeter) Float64Gauge(name string, _ ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	return &fakeFloat64Gauge{p: m.p, name: name}, nil
+}
+
+type fakeInt64Counter struct {
+	noop.Int64Counter
+	p    *fakeMeterProvider
+	name string
+}
+
+func (c *fakeInt64Counter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	c.p.update(c.name, attrs, func(v float64) float64 { return v + float64(incr) })
+}
+
+type fakeFloat64Histogram struct {
+	noop.Float64Histogram
+	p    *fakeMeterProvider
+	name string
+}
+
+func (h *fakeFloat64Histogram) Record(_ context.Context, _ float64, opts ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(opts).Attributes()
+	h.p.update(h.name, attrs, func(v float64) float64 { return v + 1 })
+}
+
+type fakeFloat64Gauge struct {
+	noop.Float64Gauge
+	p    *fakeMeterProvider
+	name string
+}
+
+func (g *fakeFloat64Gauge) Record(_ context.Context, value float64, opts ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(opts).Attributes()
+	g.p.update(g.name, attrs, func(float64) float64 { return value })
+}
+
+// Instruments are created against the global provider at init, and
+// forward to the first provider installed, so install it only once.
+var (
+	provider          = &fakeMeterProvider{}
+	installedProvider sync.Once
+)
+
+func TestMetrics(t *testing.T) {
+	installedProvider.Do(func() { otel.SetMeterProvider(provider) })
+	provider.mu.Lock()
+	provider.values = map[string]float64{}
+	provider.mu.Unlock()
+
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := connectTestClient(t, srv)
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Fatal(err)
+	}
+	srv.ExpireTokens()
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetDevices(ctx, 456, false); err == nil {
+		t.Fatal("expected error for unknown monitor")
+	}
+	if err := client.Stream(ctx, 123, func(_ context.Context, msg realtime.Message) error {
+		if _, ok := msg.(*realtime.RealtimeUpdate); ok {
+			return realtime.Stop
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]float64{
+		"sense.requests{operation=POST /authenticate,status=200}":                      1,
+		"sense.requests{operation=GET /app/monitors/{id}/devices/overview,status=200}": 2,
+		"sense.requests{operation=GET /app/monitors/{id}/devices/overview,status=404}": 1,
+		"sense.request.duration{operation=POST /authenticate,status=200}":              1,
+		"sense.ratelimit.wait":                                                 5,
+		"sense.auth.renewals{outcome=success}":                                 1,
+		"sense.realtime.messages{message.type=hello,monitor.id=123}":           1,
+		"sense.realtime.messages{message.type=realtime_update,monitor.id=123}": 1,
+		"sense.realtime.callback.duration{message.type=realtime_update}":       1,
+		"sense.monitor.power{monitor.id=123}":                                  590.5,
+		"sense.monitor.frequency{monitor.id=123}":                              60,
+		"sense.monitor.voltage{leg=0,monitor.id=123}":                          120.5,
+		"sense.monitor.voltage{leg=1,monitor.id=123}":                          121,
+	} {
+		if got := provider.get(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
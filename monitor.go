@@ -0,0 +1,116 @@
+package sense
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dnesting/sense/internal/client"
+)
+
+// Monitor is a Sense monitor, which is a physical device that measures power usage.
+// One account can have multiple Monitors.
+type Monitor struct {
+	ID           int
+	SerialNumber string
+
+	// TimeZone is the time zone the monitor is configured for, or nil if
+	// it is unknown or not available on this system.
+	TimeZone *time.Location
+
+	Online            bool
+	SolarConnected    bool
+	SolarConfigured   bool
+	HardwareType      string
+	EthernetSupported bool
+	ZigbeeSupported   bool
+
+	Attributes MonitorAttributes
+}
+
+// MonitorAttributes holds the details about a monitor's home and electricity
+// rates that the user has configured.
+type MonitorAttributes struct {
+	// Cost is what the user pays for electricity.  UserSetCost is true if
+	// the user entered it, rather than Sense estimating it.
+	Cost        CentsPerKWh
+	UserSetCost bool
+
+	// SellBackRate is what the user is paid for electricity returned to
+	// the grid.
+	SellBackRate        CentsPerKWh
+	UserSetSellBackRate bool
+
+	ShowCost        bool
+	TOUEnabled      bool // time-of-use rates
+	SolarTOUEnabled bool
+
+	PostalCode  string
+	PowerRegion string
+
+	HomeType          string
+	HomeSizeType      string
+	BasementType      string
+	OccupancyType     string
+	NumberOfOccupants string
+	YearBuiltType     string
+}
+
+// CentsPerKWh is an electricity rate.  Sense appears to report rates in
+// cents (or the local equivalent) per kilowatt-hour.
+type CentsPerKWh float64
+
+// PerKWh returns the rate in whole currency units per kilowatt-hour.
+func (c CentsPerKWh) PerKWh() float64 {
+	return float64(c) / 100
+}
+
+// String returns the rate formatted like "12.5¢/kWh".
+func (c CentsPerKWh) String() string {
+	return fmt.Sprintf("%g¢/kWh", float64(c))
+}
+
+// loadLocation returns the named time zone, or nil if it can't be loaded.
+func loadLocation(log *slog.Logger, name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Debug("sense: unable to load time zone", slog.String("time_zone", name), slog.Any("error", err))
+		return nil
+	}
+	return loc
+}
+
+func monitorFromClient(log *slog.Logger, m client.Monitor) Monitor {
+	a := deref(m.Attributes)
+	return Monitor{
+		ID:                deref(m.Id),
+		SerialNumber:      deref(m.SerialNumber),
+		TimeZone:          loadLocation(log, deref(m.TimeZone)),
+		Online:            deref(m.Online),
+		SolarConnected:    deref(m.SolarConnected),
+		SolarConfigured:   deref(m.SolarConfigured),
+		HardwareType:      deref(m.HardwareType),
+		EthernetSupported: deref(m.EthernetSupported),
+		ZigbeeSupported:   deref(m.ZigbeeSupported),
+		Attributes: MonitorAttributes{
+			Cost:                CentsPerKWh(deref(a.Cost)),
+			UserSetCost:         deref(a.UserSetCost),
+			SellBackRate:        CentsPerKWh(deref(a.SellBackRate)),
+			UserSetSellBackRate: deref(a.UserSetSellBackRate),
+			ShowCost:            deref(a.ShowCost),
+			TOUEnabled:          deref(a.TouEnabled),
+			SolarTOUEnabled:     deref(a.SolarTouEnabled),
+			PostalCode:          deref(a.PostalCode),
+			PowerRegion:         deref(a.PowerRegion),
+			HomeType:            deref(a.HomeType),
+			HomeSizeType:        deref(a.HomeSizeType),
+			BasementType:        deref(a.BasementType),
+			OccupancyType:       deref(a.OccupancyType),
+			NumberOfOccupants:   deref(a.NumberOfOccupants),
+			YearBuiltType:       deref(a.YearBuiltType),
+		},
+	}
+}
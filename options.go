@@ -1,8 +1,12 @@
 package sense
 
 import (
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/dnesting/sense/ratelimited"
+	"github.com/dnesting/sense/realtime"
 	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 )
@@ -13,9 +17,16 @@ import (
 type newOptions struct {
 	httpClient     *http.Client
 	rateLimit      *rate.Limit
+	limiter        ratelimited.Limiter
+	opLimits       map[string]ratelimited.Limiter
+	retry          *RetryPolicy
+	logger         *slog.Logger
 	apiUrl         string
 	realtimeApiUrl string
 	realtimeOrigin string
+	reconnect      *realtime.Backoff
+	idleTimeout    time.Duration
+	tokenStore     TokenStore
 
 	internalClient         internalClient
 	internalRealtimeClient internalRealtimeClient
@@ -40,12 +51,50 @@ func WithHttpClient(httpClient *http.Client) Option {
 // WithRateLimit applies a rate limit to requests made to the Sense API.
 // Without this option, a default rate limit of 10 requests/second will be applied.
 // You can disable rate limiting by providing a limit of 0.
+//
+// Each Client gets its own limit.  To share a limit among several clients,
+// use [WithLimiter].
 func WithRateLimit(limit rate.Limit) Option {
 	return func(o *newOptions) {
 		o.rateLimit = &limit
 	}
 }
 
+// WithLimiter uses l to limit the rate of requests made to the Sense API,
+// instead of the limit from [WithRateLimit].  Clients created with the same
+// l share the limit, which is useful when running several clients for the
+// same account:
+//
+//	limiter := ratelimited.New(5, 5)
+//	c1 := sense.New(sense.WithLimiter(limiter))
+//	c2 := sense.New(sense.WithLimiter(limiter))
+func WithLimiter(l ratelimited.Limiter) Option {
+	return func(o *newOptions) {
+		o.limiter = l
+	}
+}
+
+// WithOperationLimit applies l, in addition to the overall limit, to
+// requests whose URL path ends with path.  This can be used to apply a
+// stricter limit to authentication requests:
+//
+//	slow := ratelimited.New(rate.Every(10*time.Second), 1)
+//	sense.New(
+//		sense.WithOperationLimit("/authenticate", slow),
+//		sense.WithOperationLimit("/renew", slow))
+//
+// Like [WithLimiter], l can be shared among clients.
+func WithOperationLimit(path string, l ratelimited.Limiter) Option {
+	return func(o *newOptions) {
+		limits := make(map[string]ratelimited.Limiter, len(o.opLimits)+1)
+		for k, v := range o.opLimits {
+			limits[k] = v
+		}
+		limits[path] = l
+		o.opLimits = limits
+	}
+}
+
 // WithApiUrl sets the base URLs for the Sense API.
 // If this option is not provided, the standard production API URLs will be used
 // (https://api.sense.com/apiservice/api/v1/).
@@ -76,6 +125,47 @@ func WithDeviceID(id string) Option {
 	}
 }
 
+// WithReconnect causes [Client.Stream] to re-establish its connection
+// according to the provided policy whenever it fails.  Callbacks will
+// receive [realtime.Disconnected] and [realtime.Reconnected] messages
+// to indicate gaps in the data.
+//
+// Use [realtime.DefaultBackoff] for a reasonable default.
+func WithReconnect(b realtime.Backoff) Option {
+	return func(o *newOptions) {
+		o.reconnect = &b
+	}
+}
+
+// WithIdleTimeout causes [Client.Stream] to treat the connection as failed
+// with [realtime.ErrStalled] if no message is received within d.  Combine
+// this with [WithReconnect] to recover from stalled connections automatically.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *newOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// WithTokenStore causes the client to save its session to store after
+// authenticating, and to resume a stored session (renewing its token if
+// needed) rather than authenticating with credentials whenever possible.
+// Renewed tokens are also saved to the store.
+func WithTokenStore(store TokenStore) Option {
+	return func(o *newOptions) {
+		o.tokenStore = store
+	}
+}
+
+// WithLogger sends the client's log records to l, including those from
+// authentication and the real-time API.  Most records are at debug level.
+// Without this option, the logger set with [SetDebug] is used, if
+// any; otherwise nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *newOptions) {
+		o.logger = l
+	}
+}
+
 func getOptions(build newOptions, opts ...Option) *newOptions {
 	for _, o := range opts {
 		o(&build)
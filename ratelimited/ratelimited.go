@@ -0,0 +1,110 @@
+// Package ratelimited provides a rate-limited HTTP client.
+//
+// A [Limiter] can be shared by several clients (such as several
+// sense.Client instances for the same account) so that together they
+// stay within a single limit.
+package ratelimited
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+const traceName = "github.com/dnesting/sense"
+
+var waitDuration = func() metric.Float64Histogram {
+	h, err := otel.Meter(traceName).Float64Histogram("sense.ratelimit.wait",
+		metric.WithDescription("Time requests spent waiting for rate limiters"),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return h
+}()
+
+// Limiter is a function that is expected to wait until rate limiting
+// conditions have been met.  The implementation should return early
+// if the provided context expires.
+type Limiter func(context.Context) error
+
+// New returns a Limiter that allows events up to rate r, with bursts of
+// at most b events.  See [rate.NewLimiter].
+func New(r rate.Limit, b int) Limiter {
+	return rate.NewLimiter(r, b).Wait
+}
+
+// Transport is an http.RoundTripper that calls L to apply a rate limit
+// to requests.  If Transport is nil, http.DefaultTransport is used.
+// If L is nil, no rate limiting is applied.
+type Transport struct {
+	L Limiter
+	// Paths holds additional limiters for requests whose URL path ends
+	// with the key, such as "/authenticate".  These are applied after L.
+	Paths map[string]Limiter
+	Base  interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+}
+
+// limiters returns the limiters that apply to r.
+func (t *Transport) limiters(r *http.Request) (ls []Limiter) {
+	if t.L != nil {
+		ls = append(ls, t.L)
+	}
+	for suffix, l := range t.Paths {
+		if l != nil && strings.HasSuffix(r.URL.Path, suffix) {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Apply the rate limits for this Transport.
+	if ls := t.limiters(r); len(ls) > 0 {
+		ctx, span := otel.Tracer(traceName).Start(r.Context(), "rate limit")
+		start := time.Now()
+		for _, l := range ls {
+			if err := l(ctx); err != nil {
+				span.RecordError(err)
+				span.End()
+				return nil, err
+			}
+		}
+		waitDuration.Record(ctx, time.Since(start).Seconds())
+		span.End()
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultClient
+	}
+	return base.Do(r)
+}
+
+// NewClient creates a new HTTP client that calls limiter to apply a
+// rate limit to requests.  If client is nil, http.DefaultClient is used.
+// If limiter is nil, no rate limiting is applied.
+func NewClient(client *http.Client, limiter Limiter) *http.Client {
+	return NewClientWithPaths(client, limiter, nil)
+}
+
+// NewClientWithPaths is like [NewClient], but also applies the limiters
+// in paths to requests whose URL path ends with the corresponding key.
+func NewClientWithPaths(client *http.Client, limiter Limiter, paths map[string]Limiter) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &Transport{
+			L:     limiter,
+			Paths: paths,
+			Base:  client,
+		},
+	}
+}
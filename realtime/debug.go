@@ -1,28 +1,43 @@
 package realtime
 
 import (
-	"fmt"
+	"io"
 	"log"
-	"strings"
+	"log/slog"
+	"sync/atomic"
 )
 
-var debugLogger *log.Logger
+var debugLogger atomic.Pointer[slog.Logger]
 
-func debugf(format string, args ...interface{}) {
-	if debugLogger != nil {
-		debugLogger.Output(2, strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+// discardLogger is used when no logger has been provided, so the library
+// stays quiet unless asked otherwise.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// logger returns l, or if that is nil, the logger set with SetDebug,
+// or a logger that discards everything.
+func logger(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	if l := debugLogger.Load(); l != nil {
+		return l
 	}
+	return discardLogger
 }
 
-/*
-func debug(args ...interface{}) {
-	if debugLogger != nil {
-		debugLogger.Output(2, strings.TrimRight(fmt.Sprint(args...), "\n"))
-	}
+// log returns the logger for this client.
+func (c *Client) log() *slog.Logger {
+	return logger(c.Logger)
 }
-*/
 
-// SetDebug enables debug logging using the given logger. Set to nil to disable.
+// SetDebug enables debug logging using the given logger, for clients that
+// don't have their own Logger. Set to nil to disable.
+//
+// Deprecated: Set [Client.Logger] instead.
 func SetDebug(l *log.Logger) {
-	debugLogger = l
+	if l == nil {
+		debugLogger.Store(nil)
+		return
+	}
+	debugLogger.Store(slog.New(slog.NewTextHandler(l.Writer(), &slog.HandlerOptions{Level: slog.LevelDebug})))
 }
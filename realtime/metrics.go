@@ -0,0 +1,71 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// metrics holds the OpenTelemetry instruments for this package.  They are
+// created using the global MeterProvider, which forwards to whatever
+// provider is later installed with otel.SetMeterProvider.
+var metrics struct {
+	messages         metric.Int64Counter
+	reconnects       metric.Int64Counter
+	callbackDuration metric.Float64Histogram
+
+	// Latest values from RealtimeUpdate messages
+	power     metric.Float64Gauge
+	voltage   metric.Float64Gauge
+	frequency metric.Float64Gauge
+}
+
+func init() {
+	meter := otel.Meter(traceName)
+	var errs [6]error
+	metrics.messages, errs[0] = meter.Int64Counter("sense.realtime.messages",
+		metric.WithDescription("Real-time messages received, by type"),
+		metric.WithUnit("{message}"))
+	metrics.reconnects, errs[1] = meter.Int64Counter("sense.realtime.reconnects",
+		metric.WithDescription("Attempts to re-establish a real-time connection"),
+		metric.WithUnit("{attempt}"))
+	metrics.callbackDuration, errs[2] = meter.Float64Histogram("sense.realtime.callback.duration",
+		metric.WithDescription("Time spent in Stream callbacks, by message type"),
+		metric.WithUnit("s"))
+	metrics.power, errs[3] = meter.Float64Gauge("sense.monitor.power",
+		metric.WithDescription("Most recent total power reported by the monitor"),
+		metric.WithUnit("W"))
+	metrics.voltage, errs[4] = meter.Float64Gauge("sense.monitor.voltage",
+		metric.WithDescription("Most recent voltage reported by the monitor, by leg"),
+		metric.WithUnit("V"))
+	metrics.frequency, errs[5] = meter.Float64Gauge("sense.monitor.frequency",
+		metric.WithDescription("Most recent AC frequency reported by the monitor"),
+		metric.WithUnit("Hz"))
+	if err := errors.Join(errs[:]...); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// recordMessage updates metrics for a message received from monitorID.
+func recordMessage(ctx context.Context, monitorID int, msg Message) {
+	monitor := attribute.Int("monitor.id", monitorID)
+	metrics.messages.Add(ctx, 1, metric.WithAttributes(monitor, attribute.String("message.type", msg.GetType())))
+
+	u, ok := msg.(*RealtimeUpdate)
+	if !ok {
+		return
+	}
+	attrs := metric.WithAttributes(monitor)
+	metrics.power.Record(ctx, float64(u.W), attrs)
+	if u.Hz != 0 {
+		metrics.frequency.Record(ctx, float64(u.Hz), attrs)
+	}
+	for i, v := range u.Voltage {
+		metrics.voltage.Record(ctx, float64(v),
+			metric.WithAttributes(monitor, attribute.String("leg", strconv.Itoa(i))))
+	}
+}
@@ -30,15 +30,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/coder/websocket"
+	"github.com/dnesting/sense/internal/client"
+	"github.com/dnesting/sense/internal/redact"
+	"github.com/dnesting/sense/senseauth"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
 )
 
@@ -232,19 +238,30 @@ type TimelineEvent struct {
 	UserDeviceType            string                   `json:"user_device_type"`
 }
 
-var unexpectedMessageTypes = map[string]bool{}
+// unexpectedMessageTypes records the message types we've failed to parse,
+// so that we only log the first of each.
+var unexpectedMessageTypes sync.Map
+
+// warnUnexpected logs a message that couldn't be parsed, unless we've
+// already logged one of the same type.
+func warnUnexpected(log *slog.Logger, msgType string, err error, buf []byte) {
+	if _, seen := unexpectedMessageTypes.LoadOrStore(msgType, true); seen {
+		return
+	}
+	log.Warn("realtime: unable to parse message (future messages of this type suppressed)",
+		slog.String("type", msgType),
+		slog.Any("error", err),
+		slog.String("dump", hex.Dump(buf)))
+}
 
 // Given bytes from a websocket message, parse out the Type and then
 // the ultimate payload message.
-func parseMessage(buf []byte) (msg Message, err error) {
+func parseMessage(log *slog.Logger, buf []byte) (msg Message, err error) {
 	var discriminator struct {
 		Type string `json:"type"`
 	}
 	if err = json.Unmarshal(buf, &discriminator); err != nil {
-		if !unexpectedMessageTypes[""] {
-			unexpectedMessageTypes[""] = true
-			log.Print("unable to parse message type (future messages suppressed): ", err, "\n", hex.Dump(buf))
-		}
+		warnUnexpected(log, "", err, buf)
 		return nil, err
 	}
 
@@ -283,10 +300,7 @@ func parseMessage(buf []byte) (msg Message, err error) {
 		err = fmt.Errorf("unknown message type: %s", discriminator.Type)
 	}
 	if err != nil {
-		if !unexpectedMessageTypes[discriminator.Type] {
-			unexpectedMessageTypes[discriminator.Type] = true
-			log.Print("unable to parse message (future messages suppressed): ", err, "\n", hex.Dump(buf))
-		}
+		warnUnexpected(log, discriminator.Type, err, buf)
 		return nil, err
 	}
 	return msg, nil
@@ -334,8 +348,28 @@ type Client struct {
 	DeviceID   string
 	TokenSrc   oauth2.TokenSource
 	Dialer     Dialer
+
+	// Reconnect, if set, causes Stream to re-establish the connection
+	// when it fails, using the given backoff policy.  A fresh access
+	// token is obtained from TokenSrc for every attempt.
+	Reconnect *Backoff
+
+	// IdleTimeout, if non-zero, is how long Stream will wait for a message
+	// before it considers the connection stalled.  A stalled connection is
+	// closed and treated as failed with [ErrStalled].  Since RealtimeUpdate
+	// messages normally arrive about once a second, a value of 30 seconds
+	// or so is reasonable.  Time spent in the callback is not counted.
+	IdleTimeout time.Duration
+
+	// Logger receives log records for this client.  If nil, the logger
+	// set with SetDebug is used, if any.
+	Logger *slog.Logger
 }
 
+// ErrStalled is returned by [Client.Stream] when no message has been received
+// within [Client.IdleTimeout].
+var ErrStalled = errors.New("realtime: connection stalled")
+
 // Stop is a sentinel error that can be returned from a callback to stop the
 // stream.
 //
@@ -346,7 +380,7 @@ var Stop = errors.New("stop sentinel")
 // [Message.GetType] or a type assertion to determine the type of the message.
 type Callback func(context.Context, Message) error
 
-func (c *Client) buildRequest(monitorID int) (string, websocket.DialOptions, error) {
+func (c *Client) buildRequest(ctx context.Context, monitorID int) (string, websocket.DialOptions, error) {
 	opts := websocket.DialOptions{
 		HTTPClient: c.HttpClient,
 		HTTPHeader: http.Header{
@@ -356,7 +390,7 @@ func (c *Client) buildRequest(monitorID int) (string, websocket.DialOptions, err
 
 	u, err := url.Parse(c.BaseUrl)
 	if err != nil {
-		return "", opts, err
+		return "", opts, &permanentError{err}
 	}
 	u = u.ResolveReference(&url.URL{Path: "monitors/" + strconv.Itoa(monitorID) + "/realtimefeed"})
 
@@ -370,8 +404,15 @@ func (c *Client) buildRequest(monitorID int) (string, websocket.DialOptions, err
 
 	var tok *oauth2.Token
 	if c.TokenSrc != nil {
-		tok, err = c.TokenSrc.Token()
+		if src, ok := c.TokenSrc.(contextTokenSource); ok {
+			tok, err = src.TokenContext(ctx)
+		} else {
+			tok, err = c.TokenSrc.Token()
+		}
 		if err != nil {
+			if tokenRejected(err) {
+				err = &permanentError{err}
+			}
 			return "", opts, err
 		}
 		params["access_token"] = []string{tok.AccessToken}
@@ -380,8 +421,31 @@ func (c *Client) buildRequest(monitorID int) (string, websocket.DialOptions, err
 	return u.String(), opts, nil
 }
 
+// contextTokenSource is implemented by token sources that can renew tokens
+// using a context, such as *senseauth.TokenSource.
+type contextTokenSource interface {
+	TokenContext(ctx context.Context) (*oauth2.Token, error)
+}
+
+// tokenRejected returns true if err indicates that the token source can't
+// produce a usable token, no matter how often we ask.
+func tokenRejected(err error) bool {
+	return errors.Is(err, client.ErrAuthenticationNeeded) ||
+		errors.Is(err, senseauth.ErrTokenMissingUserID) ||
+		errors.Is(err, senseauth.ErrNoToken)
+}
+
+// permanentError wraps errors that reconnecting won't fix, such as an
+// invalid URL or a token the server won't accept.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
 // Reads incoming messages from the websocket and relays them back to the messageLoop.
-func readLoop(ctx context.Context, ws Conn, ch chan<- Message) error {
+func readLoop(ctx context.Context, log *slog.Logger, ws Conn, ch chan<- Message) error {
 	for {
 		mtype, buf, err := ws.Read(ctx)
 		if err != nil {
@@ -390,35 +454,91 @@ func readLoop(ctx context.Context, ws Conn, ch chan<- Message) error {
 		if mtype != websocket.MessageText {
 			continue
 		}
-		msg, err := parseMessage(buf)
+		msg, err := parseMessage(log, buf)
 		if err == nil {
-			ch <- msg
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 }
 
+// callbackError wraps errors returned by the callback, so that they can be
+// distinguished from errors with the connection itself.
+type callbackError struct {
+	err error
+}
+
+func (e *callbackError) Error() string { return e.err.Error() }
+func (e *callbackError) Unwrap() error { return e.err }
+
+// unwrapCallbackError returns the error returned by the callback, if err
+// originated there, otherwise err.
+func unwrapCallbackError(err error) error {
+	if cerr, ok := err.(*callbackError); ok {
+		return cerr.err
+	}
+	return err
+}
+
 // Spawns readLoop and calls the callback for each message received.
-func messageLoop(ctx context.Context, ws Conn, callback Callback) error {
+// If received is non-nil, it will be set to true once any message
+// has been received.  If idleTimeout is non-zero and no message arrives
+// within that time, the connection is closed and ErrStalled is returned.
+func messageLoop(ctx context.Context, log *slog.Logger, monitorID int, ws Conn, callback Callback, received *bool, idleTimeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops readLoop if we return early
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if idleTimeout > 0 {
+		timer = time.NewTimer(idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
 	ch := make(chan Message)
 	var readErr error
 	go func() {
-		readErr = readLoop(ctx, ws, ch)
+		readErr = readLoop(ctx, log, ws, ch)
 		close(ch)
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ws.Close(websocket.StatusNormalClosure, "")
+			ws.Close(websocket.StatusNormalClosure, "")
+			return ctx.Err()
+		case <-idle:
+			log.Debug("realtime: no message received, closing connection",
+				slog.Duration("idle_timeout", idleTimeout))
+			span := trace.SpanFromContext(ctx)
+			span.AddEvent("stalled", trace.WithAttributes(
+				attribute.String("idle_timeout", idleTimeout.String()),
+			))
+			span.SetAttributes(attribute.Bool("realtime.stalled", true))
+			ws.Close(websocket.StatusGoingAway, "idle timeout")
+			return ErrStalled
 		case msg, ok := <-ch:
 			if !ok {
 				return readErr
 			}
+			if received != nil {
+				*received = true
+			}
+			recordMessage(ctx, monitorID, msg)
 			err := func() error {
 				ctx, span := otel.Tracer(traceName).Start(ctx, fmt.Sprintf("Handle %T", msg))
 				defer span.End()
 				span.SetAttributes(attribute.String("message.type", msg.GetType()))
-				debugf("running callback for %T", msg)
+				log.Debug("realtime: running callback", slog.String("type", msg.GetType()))
+				start := time.Now()
+				defer func() {
+					metrics.callbackDuration.Record(ctx, time.Since(start).Seconds(),
+						metric.WithAttributes(attribute.String("message.type", msg.GetType())))
+				}()
 				return callback(ctx, msg)
 			}()
 			if err != nil {
@@ -427,22 +547,22 @@ func messageLoop(ctx context.Context, ws Conn, callback Callback) error {
 					return nil
 				}
 				ws.Close(websocket.StatusInternalError, "")
-				return err
+				return &callbackError{err}
+			}
+			if timer != nil {
+				timer.Reset(idleTimeout)
 			}
 		}
 	}
 }
 
-// Stream opens a websocket connection to the given monitor and calls the
-// callback for each message received.  The callback can return the sentinel
-// error [Stop] to stop the stream.
-func (c *Client) Stream(ctx context.Context, monitorID int, callback Callback) error {
-	ctx, span := otel.Tracer(traceName).Start(ctx, "Stream")
-	defer span.End()
-
-	uri, opts, err := c.buildRequest(monitorID)
+// connect dials the given monitor and runs the messageLoop until the
+// connection ends.  If onConnect is non-nil, it is called after the
+// connection has been established, before any messages are delivered.
+// Errors from the callback (or onConnect) are returned as *callbackError.
+func (c *Client) connect(ctx context.Context, monitorID int, callback Callback, onConnect func() error, received *bool) error {
+	uri, opts, err := c.buildRequest(ctx, monitorID)
 	if err != nil {
-		span.RecordError(err)
 		return err
 	}
 
@@ -451,21 +571,64 @@ func (c *Client) Stream(ctx context.Context, monitorID int, callback Callback) e
 		dialer = &realDialer{}
 	}
 
-	debugf("dialing %q", uri)
-	ws, _, err := dialer.Dial(ctx, uri, &opts)
+	log := c.log().With(slog.Int("monitor_id", monitorID))
+	log.Debug("realtime: dialing", slog.String("url", redact.String(uri)))
+	ws, res, err := dialer.Dial(ctx, uri, &opts)
 	if err != nil {
-		err = fmt.Errorf("dial %q: %w", uri, err)
-		span.RecordError(err)
+		// The error from the dialer usually includes the URL, and with
+		// it the access token.
+		err = redact.Error(fmt.Errorf("dial %q: %w", uri, err))
+		if res != nil {
+			switch res.StatusCode {
+			case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+				return &permanentError{err}
+			}
+		}
 		return err
 	}
 
-	if err = messageLoop(ctx, ws, callback); err != nil {
-		if err == io.EOF {
+	if onConnect != nil {
+		if err := onConnect(); err != nil {
+			if err == Stop {
+				ws.Close(websocket.StatusNormalClosure, "")
+				return nil
+			}
+			ws.Close(websocket.StatusInternalError, "")
+			return &callbackError{err}
+		}
+	}
+	return messageLoop(ctx, log, monitorID, ws, callback, received, c.IdleTimeout)
+}
+
+// Stream opens a websocket connection to the given monitor and calls the
+// callback for each message received.  The callback can return the sentinel
+// error [Stop] to stop the stream, in which case Stream returns nil.  If ctx
+// is cancelled, Stream returns ctx.Err().
+//
+// If c.Reconnect is set, the connection will be re-established according
+// to that policy whenever it fails or is closed by the server.  See [Backoff].
+func (c *Client) Stream(ctx context.Context, monitorID int, callback Callback) error {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "Stream")
+	defer span.End()
+
+	var err error
+	if c.Reconnect != nil {
+		err = c.streamReconnecting(ctx, monitorID, callback, c.Reconnect)
+	} else {
+		err = c.connect(ctx, monitorID, callback, nil, nil)
+		if _, ok := err.(*callbackError); !ok && err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		} else if err == io.EOF {
 			err = nil
-		} else {
-			span.RecordError(err)
-			return err
 		}
+		if perm, ok := err.(*permanentError); ok {
+			err = perm.err
+		}
+		err = unwrapCallbackError(err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
 	}
 	return nil
 }
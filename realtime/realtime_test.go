@@ -1,18 +1,25 @@
 package realtime_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coder/websocket"
 	"github.com/dnesting/sense/internal/senseutil"
 	"github.com/dnesting/sense/realtime"
 	"github.com/dnesting/sense/senseauth"
+	"golang.org/x/oauth2"
 )
 
 type msg = senseutil.WSMsg
@@ -405,3 +412,320 @@ func Example() {
 	// Power consumption is now: 591.4 W
 	// Power consumption is now: 592.4 W
 }
+
+// seqDialer returns a new connection reading from the next channel in Chs
+// for each call to Dial.  Once Chs is exhausted, Dial returns an error.
+type seqDialer struct {
+	Chs   []chan msg
+	Dials int
+}
+
+func (d *seqDialer) Dial(ctx context.Context, urlStr string, opts *websocket.DialOptions) (realtime.Conn, *http.Response, error) {
+	d.Dials++
+	if len(d.Chs) == 0 {
+		return nil, nil, errors.New("connection refused")
+	}
+	ch := d.Chs[0]
+	d.Chs = d.Chs[1:]
+	if ch == nil {
+		return nil, nil, errors.New("connection refused")
+	}
+	return &senseutil.MockWSConn{Ch: ch}, nil, nil
+}
+
+func feed(msgs ...string) chan msg {
+	ch := make(chan msg, len(msgs))
+	for _, m := range msgs {
+		ch <- msg{T: websocket.MessageText, D: m}
+	}
+	close(ch)
+	return ch
+}
+
+func TestStreamReconnect(t *testing.T) {
+	update := `{"type":"realtime_update","payload":{"w": 1}}`
+	dialer := &seqDialer{Chs: []chan msg{
+		feed(update),
+		nil, // first reconnect attempt fails
+		feed(update, update),
+	}}
+	client := &realtime.Client{
+		Dialer:    dialer,
+		Reconnect: &realtime.Backoff{Initial: time.Millisecond},
+	}
+
+	var got []string
+	var reconnected *realtime.Reconnected
+	count := 0
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		got = append(got, msg.GetType())
+		if r, ok := msg.(*realtime.Reconnected); ok {
+			reconnected = r
+		}
+		if _, ok := msg.(*realtime.RealtimeUpdate); ok {
+			count++
+			if count == 3 {
+				return realtime.Stop
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	want := []string{"realtime_update", "disconnected", "reconnected", "realtime_update", "realtime_update"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected messages %v, got %v", want, got)
+	}
+	if dialer.Dials != 3 {
+		t.Errorf("expected 3 dials, got %d", dialer.Dials)
+	}
+	if reconnected == nil || reconnected.Attempts != 2 {
+		t.Errorf("expected reconnect after 2 attempts, got %+v", reconnected)
+	}
+}
+
+func TestStreamReconnectGivesUp(t *testing.T) {
+	dialer := &seqDialer{}
+	client := &realtime.Client{
+		Dialer:    dialer,
+		Reconnect: &realtime.Backoff{Initial: time.Millisecond, MaxAttempts: 3},
+	}
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		t.Errorf("unexpected message %T", msg)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if dialer.Dials != 4 {
+		t.Errorf("expected 4 dials (1 + 3 retries), got %d", dialer.Dials)
+	}
+}
+
+func TestStreamCallbackErrorNoReconnect(t *testing.T) {
+	dialer := &seqDialer{Chs: []chan msg{
+		feed(`{"type":"hello"}`),
+		feed(`{"type":"hello"}`),
+	}}
+	client := &realtime.Client{
+		Dialer:    dialer,
+		Reconnect: &realtime.Backoff{Initial: time.Millisecond},
+	}
+	errBoom := errors.New("boom")
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		return errBoom
+	})
+	if err != errBoom {
+		t.Errorf("expected %v, got %v", errBoom, err)
+	}
+	if dialer.Dials != 1 {
+		t.Errorf("expected 1 dial, got %d", dialer.Dials)
+	}
+}
+
+func TestStreamStalled(t *testing.T) {
+	ch := make(chan msg, 1) // never closed
+	ch <- msg{T: websocket.MessageText, D: `{"type":"hello"}`}
+	client := &realtime.Client{
+		Dialer:      &senseutil.MockWSDialer{Ch: ch},
+		IdleTimeout: 20 * time.Millisecond,
+	}
+	var got int
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		got++
+		return nil
+	})
+	if !errors.Is(err, realtime.ErrStalled) {
+		t.Errorf("expected ErrStalled, got %v", err)
+	}
+	if got != 1 {
+		t.Errorf("expected 1 message before stalling, got %d", got)
+	}
+}
+
+func TestStreamStalledReconnect(t *testing.T) {
+	stalled := make(chan msg, 1) // never closed
+	stalled <- msg{T: websocket.MessageText, D: `{"type":"hello"}`}
+	dialer := &seqDialer{Chs: []chan msg{
+		stalled,
+		feed(`{"type":"hello"}`),
+	}}
+	client := &realtime.Client{
+		Dialer:      dialer,
+		IdleTimeout: 20 * time.Millisecond,
+		Reconnect:   &realtime.Backoff{Initial: time.Millisecond},
+	}
+	var disconnectErr error
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		switch msg := msg.(type) {
+		case *realtime.Disconnected:
+			disconnectErr = msg.Err
+		case *realtime.Reconnected:
+			return realtime.Stop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if !errors.Is(disconnectErr, realtime.ErrStalled) {
+		t.Errorf("expected disconnect due to ErrStalled, got %v", disconnectErr)
+	}
+}
+
+func TestStreamDialErrorRedacted(t *testing.T) {
+	// Find an address nothing is listening on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var logged bytes.Buffer
+	client := &realtime.Client{
+		BaseUrl:   "ws://" + addr + "/",
+		TokenSrc:  oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "SECRETTOKEN"}),
+		Reconnect: &realtime.Backoff{Initial: time.Millisecond, MaxAttempts: 1},
+		Logger:    slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	err = client.Stream(context.Background(), 123, func(context.Context, realtime.Message) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("expected error to wrap *url.Error, got %T", err)
+	}
+	if strings.Contains(err.Error(), "SECRETTOKEN") || !strings.Contains(err.Error(), "access_token=REDACTED") {
+		t.Errorf("expected token to be redacted from error, got %v", err)
+	}
+	if got := logged.String(); strings.Contains(got, "SECRETTOKEN") || !strings.Contains(got, "realtime: reconnecting") {
+		t.Errorf("expected token to be redacted from log, got:\n%s", got)
+	}
+}
+
+func TestStreamCancelled(t *testing.T) {
+	// Cancelled while connected
+	for _, reconnect := range []*realtime.Backoff{nil, {Initial: time.Millisecond}} {
+		client := &realtime.Client{
+			Dialer:    &senseutil.MockWSDialer{Ch: make(chan msg, 1)}, // never closed
+			Reconnect: reconnect,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("reconnect=%v: expected context.Canceled while connected, got %v", reconnect != nil, err)
+		}
+	}
+
+	// Cancelled while waiting to reconnect
+	client := &realtime.Client{
+		Dialer:    &seqDialer{},
+		Reconnect: &realtime.Backoff{Initial: time.Hour},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled while waiting to reconnect, got %v", err)
+	}
+}
+
+// statusDialer fails every dial with a handshake response of the given status.
+type statusDialer struct {
+	status int
+	dials  int
+}
+
+func (d *statusDialer) Dial(ctx context.Context, urlStr string, opts *websocket.DialOptions) (realtime.Conn, *http.Response, error) {
+	d.dials++
+	return nil, &http.Response{StatusCode: d.status}, fmt.Errorf("expected handshake response status code 101 but got %d", d.status)
+}
+
+func TestStreamReconnectPermanentErrors(t *testing.T) {
+	noop := func(context.Context, realtime.Message) error { return nil }
+	backoff := &realtime.Backoff{Initial: time.Millisecond, MaxAttempts: 3}
+
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		dialer := &statusDialer{status: status}
+		client := &realtime.Client{Dialer: dialer, Reconnect: backoff}
+		if err := client.Stream(context.Background(), 123, noop); err == nil {
+			t.Errorf("%d: expected error", status)
+		}
+		if dialer.dials != 1 {
+			t.Errorf("%d: expected 1 dial, got %d", status, dialer.dials)
+		}
+	}
+
+	// Server errors are worth retrying.
+	dialer := &statusDialer{status: http.StatusServiceUnavailable}
+	client := &realtime.Client{Dialer: dialer, Reconnect: backoff}
+	if err := client.Stream(context.Background(), 123, noop); err == nil {
+		t.Error("expected error")
+	}
+	if dialer.dials != 4 {
+		t.Errorf("expected 4 dials for 503, got %d", dialer.dials)
+	}
+
+	// A token that can't be renewed won't get better either.
+	expired := &oauth2.Token{AccessToken: "expired", Expiry: time.Now().Add(-time.Minute)}
+	seq := &seqDialer{}
+	client = &realtime.Client{
+		Dialer:    seq,
+		Reconnect: backoff,
+		TokenSrc:  senseauth.DefaultConfig.TokenSource(expired),
+	}
+	if err := client.Stream(context.Background(), 123, noop); !errors.Is(err, senseauth.ErrTokenMissingUserID) {
+		t.Errorf("expected ErrTokenMissingUserID, got %v", err)
+	}
+	if seq.Dials != 0 {
+		t.Errorf("expected no dials without a token, got %d", seq.Dials)
+	}
+
+	// Bad URLs are returned immediately too.
+	client = &realtime.Client{BaseUrl: "ws://[::1", Reconnect: backoff}
+	if err := client.Stream(context.Background(), 123, noop); err == nil {
+		t.Error("expected error for invalid URL")
+	}
+}
+
+// ctxTokenSource records the context it was asked for a token with.
+type ctxTokenSource struct {
+	ctx context.Context
+}
+
+func (s *ctxTokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+func (s *ctxTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	s.ctx = ctx
+	return &oauth2.Token{AccessToken: "token"}, nil
+}
+
+func TestStreamTokenContext(t *testing.T) {
+	src := &ctxTokenSource{}
+	ch := make(chan msg, 1)
+	ch <- msg{T: websocket.MessageText, D: `{"type":"hello"}`}
+	client := &realtime.Client{Dialer: &senseutil.MockWSDialer{Ch: ch}, TokenSrc: src}
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "stream")
+	if err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+		return realtime.Stop
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if src.ctx == nil || src.ctx.Value(ctxKey{}) != "stream" {
+		t.Error("expected the token to be requested with the stream's context")
+	}
+}
@@ -0,0 +1,197 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Backoff describes how [Client.Stream] should re-establish a connection
+// that has failed or been closed by the server.
+//
+// Delays between attempts start at Initial and grow by Multiplier after each
+// consecutive failure, up to Max.  Jitter randomizes each delay by up to that
+// fraction in either direction, so that many clients don't reconnect in
+// lockstep.
+//
+// The attempt count and elapsed time are reset once a connection delivers
+// a message.
+//
+// Errors that reconnecting can't fix are returned without retrying.  These
+// include an invalid [Client.BaseUrl], a token source that can't produce
+// a usable token, and a server that rejects the connection with 401, 403,
+// or 404.
+type Backoff struct {
+	// Initial is the delay before the first reconnection attempt.
+	// If zero, 1 second is used.
+	Initial time.Duration
+	// Max is the longest delay between attempts.  If zero, 1 minute is used.
+	Max time.Duration
+	// Multiplier is applied to the delay after each failed attempt.
+	// If less than 1, 2 is used.
+	Multiplier float64
+	// Jitter is the fraction (0 to 1) by which each delay is randomized.
+	Jitter float64
+
+	// MaxAttempts is the number of consecutive failed attempts after which
+	// Stream gives up and returns the last error.  If zero, there is no limit.
+	MaxAttempts int
+	// MaxElapsed is how long Stream will keep trying to reconnect after the
+	// connection was lost before it gives up.  If zero, there is no limit.
+	MaxElapsed time.Duration
+}
+
+// DefaultBackoff is a reasonable reconnection policy that retries forever.
+var DefaultBackoff = Backoff{
+	Initial:    time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// delay returns the duration to wait before the given attempt (starting at 1).
+func (b *Backoff) delay(attempt int) time.Duration {
+	initial := b.Initial
+	if initial <= 0 {
+		initial = time.Second
+	}
+	maxDelay := b.Max
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+	mult := b.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if b.Jitter > 0 {
+		d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	}
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	return time.Duration(d)
+}
+
+// exhausted returns true if no more attempts should be made.
+func (b *Backoff) exhausted(attempts int, elapsed time.Duration) bool {
+	if b.MaxAttempts > 0 && attempts >= b.MaxAttempts {
+		return true
+	}
+	if b.MaxElapsed > 0 && elapsed >= b.MaxElapsed {
+		return true
+	}
+	return false
+}
+
+// Disconnected is a synthetic message delivered to the callback when a
+// reconnecting [Client.Stream] loses its connection.  Data will be missing
+// until a corresponding [Reconnected] message is delivered.
+type Disconnected struct {
+	// Err is the reason the connection was lost.
+	Err error
+}
+
+func (d *Disconnected) GetType() string { return "disconnected" }
+
+// Reconnected is a synthetic message delivered to the callback when a
+// reconnecting [Client.Stream] has re-established its connection.
+type Reconnected struct {
+	// Attempts is the number of attempts it took to reconnect.
+	Attempts int
+	// Downtime is how long the stream was disconnected.
+	Downtime time.Duration
+}
+
+func (r *Reconnected) GetType() string { return "reconnected" }
+
+// streamReconnecting implements Stream when a reconnect policy is configured.
+func (c *Client) streamReconnecting(ctx context.Context, monitorID int, callback Callback, b *Backoff) error {
+	span := trace.SpanFromContext(ctx)
+	log := c.log().With(slog.Int("monitor_id", monitorID))
+
+	var (
+		everConnected bool
+		attempts      int
+		lostAt        time.Time
+	)
+	for {
+		var connected, received bool
+		onConnect := func() error {
+			connected = true
+			if !everConnected {
+				everConnected = true
+				return nil
+			}
+			downtime := time.Since(lostAt)
+			log.Debug("realtime: reconnected",
+				slog.Int("attempts", attempts),
+				slog.Duration("downtime", downtime))
+			return callback(ctx, &Reconnected{Attempts: attempts, Downtime: downtime})
+		}
+		err := c.connect(ctx, monitorID, callback, onConnect, &received)
+		if err == nil {
+			// callback returned Stop
+			return nil
+		}
+		if cerr, ok := err.(*callbackError); ok {
+			return cerr.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if perm, ok := err.(*permanentError); ok {
+			log.Debug("realtime: not reconnecting", slog.Any("error", perm.err))
+			return perm.err
+		}
+
+		if connected {
+			log.Debug("realtime: lost connection", slog.Any("error", err))
+			if cbErr := callback(ctx, &Disconnected{Err: err}); cbErr != nil {
+				if cbErr == Stop {
+					return nil
+				}
+				return cbErr
+			}
+		}
+		if received || lostAt.IsZero() {
+			// This connection was healthy (or this is the first attempt),
+			// so start counting again.
+			attempts = 0
+			lostAt = time.Now()
+		}
+
+		if b.exhausted(attempts, time.Since(lostAt)) {
+			return fmt.Errorf("realtime: giving up after %d attempts: %w", attempts, err)
+		}
+		attempts++
+		delay := b.delay(attempts)
+		metrics.reconnects.Add(ctx, 1, metric.WithAttributes(attribute.Int("monitor.id", monitorID)))
+		span.AddEvent("reconnect", trace.WithAttributes(
+			attribute.Int("attempt", attempts),
+			attribute.String("error", err.Error()),
+		))
+		log.Debug("realtime: reconnecting",
+			slog.Duration("delay", delay),
+			slog.Int("attempt", attempts),
+			slog.Any("error", err))
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
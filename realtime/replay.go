@@ -0,0 +1,259 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Frame is a single websocket frame as written by a [Recorder] and read
+// by a [ReplayDialer].  Frames are stored one per line as JSON.
+type Frame struct {
+	// Time is when the frame was received.
+	Time time.Time `json:"time"`
+	// URL is the URL of the connection the frame was received on, without
+	// its query string.
+	URL string `json:"url,omitempty"`
+	// Type is "text" or "binary".  If empty, frames with a Binary payload
+	// are binary, and others are text.
+	Type string `json:"type,omitempty"`
+	// Text holds the payload of a text frame.
+	Text string `json:"text,omitempty"`
+	// Binary holds the payload of a binary frame.
+	Binary []byte `json:"binary,omitempty"`
+}
+
+// Recorder is a [Dialer] that records every frame received on the
+// connections it dials as JSON lines.  Use it as [Client.Dialer] to capture
+// a session for later replay with [ReplayDialer].  Create one with
+// [NewRecorder].
+//
+//	f, _ := os.Create("session.jsonl")
+//	defer f.Close()
+//	client.Dialer = realtime.NewRecorder(f, nil)
+type Recorder struct {
+	// Dialer is used to make the actual connection.  If nil, a real
+	// websocket connection is made.
+	Dialer Dialer
+
+	// Logger receives log records for this recorder.  If nil, the logger
+	// set with SetDebug is used, if any.
+	Logger *slog.Logger
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+var _ Dialer = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder that writes frames to w, dialing
+// connections using d (or a real websocket connection if d is nil).
+func NewRecorder(w io.Writer, d Dialer) *Recorder {
+	return &Recorder{
+		Dialer: d,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+// Err returns the first error encountered writing frames, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) Dial(ctx context.Context, url string, opts *websocket.DialOptions) (Conn, *http.Response, error) {
+	d := r.Dialer
+	if d == nil {
+		d = &realDialer{}
+	}
+	conn, resp, err := d.Dial(ctx, url, opts)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &recordingConn{Conn: conn, r: r, url: stripQuery(url)}, resp, nil
+}
+
+func (r *Recorder) write(f *Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err := r.enc.Encode(f); err != nil {
+		logger(r.Logger).Debug("realtime: recorder failed", slog.Any("error", err))
+		r.err = err
+	}
+}
+
+// Values for Frame.Type.
+const (
+	frameText   = "text"
+	frameBinary = "binary"
+)
+
+// stripQuery removes the query string from a URL, since ours contains
+// the access token.
+func stripQuery(u string) string {
+	u, _, _ = strings.Cut(u, "?")
+	return u
+}
+
+// urlPath returns the path portion of u, which identifies the monitor.
+func urlPath(u string) string {
+	if parsed, err := url.Parse(u); err == nil {
+		return parsed.Path
+	}
+	return stripQuery(u)
+}
+
+type recordingConn struct {
+	Conn
+	r   *Recorder
+	url string
+}
+
+func (c *recordingConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	typ, buf, err := c.Conn.Read(ctx)
+	if err == nil {
+		f := &Frame{Time: time.Now(), URL: c.url}
+		if typ == websocket.MessageText {
+			f.Type = frameText
+			f.Text = string(buf)
+		} else {
+			f.Type = frameBinary
+			f.Binary = buf
+		}
+		c.r.write(f)
+	}
+	return typ, buf, err
+}
+
+// ReplayDialer is a [Dialer] that replays frames previously captured by
+// a [Recorder] instead of connecting to Sense.  Each call to Dial opens
+// Filename and replays it from the beginning, skipping any frames recorded
+// from a different path (that is, a different monitor) than the one
+// requested.  Frames without a URL are always replayed.  Use it as
+// [Client.Dialer].
+//
+// Speed controls pacing.  A Speed of 1 replays frames with the same
+// timing with which they were recorded, 10 replays them ten times as fast,
+// and so on.  If Speed is zero, frames are replayed as fast as possible.
+//
+// When the recording is exhausted, reads return io.EOF, which ends the
+// stream normally (unless [Client.Reconnect] is set, in which case the
+// recording will start over).
+type ReplayDialer struct {
+	Filename string
+	Speed    float64
+
+	// Logger receives log records for this dialer.  If nil, the logger
+	// set with SetDebug is used, if any.
+	Logger *slog.Logger
+}
+
+var _ Dialer = (*ReplayDialer)(nil)
+
+// NewReplayDialer returns a ReplayDialer that replays frames from filename.
+func NewReplayDialer(filename string, speed float64) *ReplayDialer {
+	return &ReplayDialer{Filename: filename, Speed: speed}
+}
+
+func (d *ReplayDialer) Dial(ctx context.Context, url string, opts *websocket.DialOptions) (Conn, *http.Response, error) {
+	f, err := os.Open(d.Filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger(d.Logger).Debug("realtime: replaying",
+		slog.String("file", d.Filename),
+		slog.Float64("speed", d.Speed))
+	conn := NewReplayConn(f, d.Speed)
+	conn.path = urlPath(url)
+	return conn, nil, nil
+}
+
+// ReplayConn is a [Conn] that reads frames written by a [Recorder].
+// See [ReplayDialer] for the meaning of speed.
+type ReplayConn struct {
+	rc    io.ReadCloser
+	sc    *bufio.Scanner
+	speed float64
+	path  string // if non-empty, only frames from this path are replayed
+
+	line  int
+	first time.Time // time of the first recorded frame
+	start time.Time // when we returned the first frame
+}
+
+var _ Conn = (*ReplayConn)(nil)
+
+// NewReplayConn returns a ReplayConn that reads recorded frames from rc.
+// The ReplayConn takes ownership of rc and will close it when Close is called.
+func NewReplayConn(rc io.ReadCloser, speed float64) *ReplayConn {
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(nil, 16*1024*1024) // realtime_update frames can be large
+	return &ReplayConn{rc: rc, sc: sc, speed: speed}
+}
+
+func (c *ReplayConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	var f Frame
+	for {
+		if !c.sc.Scan() {
+			if err := c.sc.Err(); err != nil {
+				return 0, nil, err
+			}
+			return 0, nil, io.EOF
+		}
+		c.line++
+		if len(c.sc.Bytes()) == 0 {
+			continue
+		}
+		f = Frame{}
+		if err := json.Unmarshal(c.sc.Bytes(), &f); err != nil {
+			return 0, nil, fmt.Errorf("replay: line %d: %w", c.line, err)
+		}
+		if c.path != "" && f.URL != "" && urlPath(f.URL) != c.path {
+			continue
+		}
+		break
+	}
+
+	if c.speed > 0 {
+		if c.start.IsZero() {
+			c.first = f.Time
+			c.start = time.Now()
+		} else {
+			offset := time.Duration(float64(f.Time.Sub(c.first)) / c.speed)
+			if wait := time.Until(c.start.Add(offset)); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return 0, nil, ctx.Err()
+				case <-t.C:
+				}
+			}
+		}
+	}
+
+	if f.Type == frameBinary || (f.Type == "" && f.Binary != nil) {
+		return websocket.MessageBinary, f.Binary, nil
+	}
+	return websocket.MessageText, []byte(f.Text), nil
+}
+
+func (c *ReplayConn) Close(websocket.StatusCode, string) error {
+	return c.rc.Close()
+}
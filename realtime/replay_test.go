@@ -0,0 +1,166 @@
+package realtime_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/dnesting/sense/internal/senseutil"
+	"github.com/dnesting/sense/realtime"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ch := make(chan msg, 3)
+	ch <- msg{T: websocket.MessageText, D: `{"type":"hello","payload":{"online": true}}`}
+	ch <- msg{T: websocket.MessageText, D: `{"type":"realtime_update","payload":{"w": 1}}`}
+	ch <- msg{T: websocket.MessageText, D: `{"type":"realtime_update","payload":{"w": 2}}`}
+	close(ch)
+
+	var buf bytes.Buffer
+	rec := realtime.NewRecorder(&buf, &senseutil.MockWSDialer{Ch: ch})
+	client := &realtime.Client{Dialer: rec, BaseUrl: "wss://example.test/"}
+	var recorded []string
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		recorded = append(recorded, msg.GetType())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var f realtime.Frame
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.URL != "wss://example.test/monitors/123/realtimefeed" {
+		t.Errorf("unexpected URL recorded: %q", f.URL)
+	}
+
+	filename := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(filename, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	replay := realtime.NewReplayDialer(filename, 0)
+	replay.Logger = slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client = &realtime.Client{Dialer: replay}
+	var replayed []string
+	var lastW float32
+	err = client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		replayed = append(replayed, msg.GetType())
+		if u, ok := msg.(*realtime.RealtimeUpdate); ok {
+			lastW = u.W
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 3 || len(recorded) != 3 {
+		t.Errorf("expected 3 messages recorded and replayed, got %v and %v", recorded, replayed)
+	}
+	if lastW != 2 {
+		t.Errorf("expected last W=2, got %v", lastW)
+	}
+	if !strings.Contains(logged.String(), "realtime: replaying") {
+		t.Errorf("expected replay to be logged to the dialer's logger, got:\n%s", logged.String())
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < 3; i++ {
+		enc.Encode(realtime.Frame{
+			Time: start.Add(time.Duration(i) * time.Second),
+			Text: `{"type":"hello"}`,
+		})
+	}
+	filename := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(filename, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 seconds of recording at 20x should take about 100ms.
+	client := &realtime.Client{Dialer: realtime.NewReplayDialer(filename, 20)}
+	began := time.Now()
+	err := client.Stream(context.Background(), 123, func(context.Context, realtime.Message) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected replay to take about 100ms, took %s", elapsed)
+	}
+}
+
+func TestReplayFiltersMonitors(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, f := range []realtime.Frame{
+		{URL: "wss://example.test/monitors/123/realtimefeed", Text: `{"type":"realtime_update","payload":{"w": 1}}`},
+		{URL: "wss://example.test/monitors/456/realtimefeed", Text: `{"type":"realtime_update","payload":{"w": 2}}`},
+		{URL: "wss://example.test/monitors/123/realtimefeed", Type: "binary"},
+		{URL: "wss://example.test/monitors/123/realtimefeed", Text: `{"type":"realtime_update","payload":{"w": 3}}`},
+	} {
+		enc.Encode(f)
+	}
+	filename := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(filename, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &realtime.Client{
+		Dialer:  realtime.NewReplayDialer(filename, 0),
+		BaseUrl: "wss://other.test/",
+	}
+	var got []float32
+	err := client.Stream(context.Background(), 123, func(_ context.Context, msg realtime.Message) error {
+		if u, ok := msg.(*realtime.RealtimeUpdate); ok {
+			got = append(got, u.W)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The empty binary frame should be skipped as binary, not parsed as text.
+	if fmt.Sprint(got) != "[1 3]" {
+		t.Errorf("expected only monitor 123's updates [1 3], got %v", got)
+	}
+}
+
+func TestRecordFrameTypes(t *testing.T) {
+	ch := make(chan msg, 2)
+	ch <- msg{T: websocket.MessageBinary, D: ""}
+	ch <- msg{T: websocket.MessageText, D: `{"type":"hello"}`}
+	close(ch)
+
+	var buf bytes.Buffer
+	client := &realtime.Client{Dialer: realtime.NewRecorder(&buf, &senseutil.MockWSDialer{Ch: ch})}
+	if err := client.Stream(context.Background(), 123, func(context.Context, realtime.Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var f realtime.Frame
+		if err := json.Unmarshal(line, &f); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, f.Type)
+	}
+	if fmt.Sprint(types) != "[binary text]" {
+		t.Errorf("expected frame types [binary text], got %v", types)
+	}
+}
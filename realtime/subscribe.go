@@ -0,0 +1,255 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+)
+
+// OverflowPolicy determines what a [Subscription] does with new messages
+// when its buffer is full because the consumer isn't keeping up.
+type OverflowPolicy int
+
+const (
+	// Block pauses the stream until the consumer makes room in the buffer.
+	// No messages are lost, but if the consumer falls far enough behind,
+	// the server may give up on the connection.
+	Block OverflowPolicy = iota
+
+	// DropOldest discards the oldest buffered message to make room for
+	// the new one.
+	DropOldest
+
+	// KeepLatest keeps at most one RealtimeUpdate in the buffer, discarding
+	// older ones as newer ones arrive.  Other message types are never
+	// discarded, and the stream blocks if the buffer fills with them.
+	KeepLatest
+)
+
+// defaultBuffer is used when SubscribeOptions.Buffer is zero.
+const defaultBuffer = 16
+
+// SubscribeOptions configures a [Subscription].  The zero value is usable.
+type SubscribeOptions struct {
+	// Buffer is the number of messages that can be held for the consumer
+	// before Overflow applies.  If zero, 16 is used.
+	Buffer int
+	// Overflow determines what happens when the buffer is full.
+	Overflow OverflowPolicy
+}
+
+// Streamer is anything with a Stream method like [Client.Stream].
+type Streamer interface {
+	Stream(ctx context.Context, monitorID int, callback Callback) error
+}
+
+// Subscription delivers messages from a stream over a channel, for callers
+// that would rather select on the feed than use a [Callback].
+//
+// Messages are delivered on C, which is closed when the stream ends.  After
+// that, Err reports why.
+type Subscription struct {
+	// C delivers messages from the stream.
+	C <-chan Message
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Subscribe starts streaming from monitorID using s and returns a
+// [Subscription] delivering the stream's messages.  The stream continues
+// until ctx is done, the stream fails, or [Subscription.Close] is called.
+// If opts is nil, default options are used.
+func Subscribe(ctx context.Context, s Streamer, monitorID int, opts *SubscribeOptions) *Subscription {
+	if opts == nil {
+		opts = &SubscribeOptions{}
+	}
+	size := opts.Buffer
+	if size <= 0 {
+		size = defaultBuffer
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan Message)
+	sub := &Subscription{
+		C:      out,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	q := newSubQueue(size, opts.Overflow)
+
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		err := s.Stream(ctx, monitorID, q.push)
+		sub.mu.Lock()
+		if sub.closed {
+			err = nil
+		} else if err == nil || parent.Err() != nil {
+			err = parent.Err()
+		}
+		sub.err = err
+		sub.mu.Unlock()
+		q.close()
+	}()
+
+	go func() {
+		defer func() {
+			<-streamDone // ensure Err is set before C is closed
+			close(out)
+			close(sub.done)
+			cancel()
+		}()
+		for {
+			msg, ok := q.pop(ctx)
+			if !ok {
+				return
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sub
+}
+
+// Subscribe starts streaming from the given monitor and returns a
+// [Subscription] delivering its messages.  See [Subscribe].
+func (c *Client) Subscribe(ctx context.Context, monitorID int, opts *SubscribeOptions) *Subscription {
+	return Subscribe(ctx, c, monitorID, opts)
+}
+
+// Done returns a channel that is closed once the subscription has ended
+// and C has been closed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the stream, or nil if it ended normally
+// or because Close was called.  If ctx passed to Subscribe was cancelled,
+// its error is returned.  Err returns nil until C has been closed.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+	default:
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the stream and waits for it to finish.  Any messages still
+// buffered are discarded.
+func (s *Subscription) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cancel()
+	<-s.done
+	return s.Err()
+}
+
+// subQueue is a bounded queue with a single producer (the stream callback)
+// and a single consumer (the goroutine feeding Subscription.C).
+type subQueue struct {
+	mu     sync.Mutex
+	msgs   []Message
+	size   int
+	policy OverflowPolicy
+	closed bool
+
+	ready chan struct{} // signalled when msgs becomes non-empty or closed
+	space chan struct{} // signalled when msgs shrinks
+}
+
+func newSubQueue(size int, policy OverflowPolicy) *subQueue {
+	return &subQueue{
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push adds msg to the queue according to its overflow policy.
+// It has the signature of a Callback.
+func (q *subQueue) push(ctx context.Context, msg Message) error {
+	for {
+		q.mu.Lock()
+		if _, ok := msg.(*RealtimeUpdate); ok && q.policy == KeepLatest {
+			for i, m := range q.msgs {
+				if _, ok := m.(*RealtimeUpdate); ok {
+					q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(q.msgs) >= q.size && q.policy == DropOldest {
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+		}
+		if len(q.msgs) < q.size {
+			q.msgs = append(q.msgs, msg)
+			q.mu.Unlock()
+			signal(q.ready)
+			return nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pop removes and returns the next message, waiting for one if necessary.
+// It returns false if the queue has been closed and drained, or if ctx is done.
+func (q *subQueue) pop(ctx context.Context) (Message, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) > 0 {
+			msg := q.msgs[0]
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+			q.mu.Unlock()
+			signal(q.space)
+			return msg, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// close indicates no more messages will be pushed.
+func (q *subQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	signal(q.ready)
+}
@@ -0,0 +1,160 @@
+package realtime_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/dnesting/sense/internal/senseutil"
+	"github.com/dnesting/sense/realtime"
+)
+
+// streamFunc adapts a function to the realtime.Streamer interface.
+type streamFunc func(context.Context, int, realtime.Callback) error
+
+func (f streamFunc) Stream(ctx context.Context, monitorID int, cb realtime.Callback) error {
+	return f(ctx, monitorID, cb)
+}
+
+// sendAll returns a Streamer that delivers msgs and then returns err.
+// finished is closed once all messages have been handed off.
+func sendAll(finished chan<- struct{}, err error, msgs ...realtime.Message) realtime.Streamer {
+	return streamFunc(func(ctx context.Context, _ int, cb realtime.Callback) error {
+		defer close(finished)
+		for _, m := range msgs {
+			if err := cb(ctx, m); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	ch := make(chan msg, 3)
+	ch <- msg{T: websocket.MessageText, D: `{"type":"hello","payload":{"online": true}}`}
+	ch <- msg{T: websocket.MessageText, D: `{"type":"realtime_update","payload":{"w": 1}}`}
+	ch <- msg{T: websocket.MessageText, D: `{"type":"realtime_update","payload":{"w": 2}}`}
+	close(ch)
+	client := &realtime.Client{Dialer: &senseutil.MockWSDialer{Ch: ch}}
+
+	sub := client.Subscribe(context.Background(), 123, nil)
+	var got []string
+	for m := range sub.C {
+		got = append(got, m.GetType())
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 messages, got %v", got)
+	}
+	if err := sub.Err(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestSubscribeError(t *testing.T) {
+	errBoom := errors.New("boom")
+	finished := make(chan struct{})
+	sub := realtime.Subscribe(context.Background(), sendAll(finished, errBoom, &realtime.Hello{}), 123, nil)
+	for range sub.C {
+	}
+	if err := sub.Err(); err != errBoom {
+		t.Errorf("expected %v, got %v", errBoom, err)
+	}
+}
+
+func TestSubscribeClose(t *testing.T) {
+	ch := make(chan msg) // never sends
+	client := &realtime.Client{Dialer: &senseutil.MockWSDialer{Ch: ch}}
+	sub := client.Subscribe(context.Background(), 123, nil)
+	if err := sub.Close(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("expected C to be closed")
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	ch := make(chan msg) // never sends
+	client := &realtime.Client{Dialer: &senseutil.MockWSDialer{Ch: ch}}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := client.Subscribe(ctx, 123, nil)
+	cancel()
+	<-sub.Done()
+	if err := sub.Err(); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	rt := func(w float32) *realtime.RealtimeUpdate { return &realtime.RealtimeUpdate{W: w} }
+
+	testCases := []struct {
+		name   string
+		policy realtime.OverflowPolicy
+		buffer int
+		send   []realtime.Message
+		check  func(t *testing.T, got []realtime.Message)
+	}{
+		{
+			name:   "DropOldest",
+			policy: realtime.DropOldest,
+			buffer: 2,
+			send:   []realtime.Message{rt(1), rt(2), rt(3), rt(4), rt(5)},
+			check: func(t *testing.T, got []realtime.Message) {
+				// one message may already be in flight to the consumer
+				if len(got) < 2 || len(got) > 3 {
+					t.Errorf("expected 2-3 messages, got %d", len(got))
+				}
+				if w := got[len(got)-1].(*realtime.RealtimeUpdate).W; w != 5 {
+					t.Errorf("expected last message to be W=5, got %v", w)
+				}
+			},
+		},
+		{
+			name:   "KeepLatest",
+			policy: realtime.KeepLatest,
+			buffer: 4,
+			send:   []realtime.Message{&realtime.Hello{}, rt(1), rt(2), &realtime.DataChange{}, rt(3)},
+			check: func(t *testing.T, got []realtime.Message) {
+				var types []string
+				var lastW float32
+				updates := 0
+				for _, m := range got {
+					types = append(types, m.GetType())
+					if u, ok := m.(*realtime.RealtimeUpdate); ok {
+						updates++
+						lastW = u.W
+					}
+				}
+				if types[0] != "hello" {
+					t.Errorf("expected hello first, got %v", types)
+				}
+				if updates > 2 {
+					t.Errorf("expected at most 2 updates, got %v", types)
+				}
+				if lastW != 3 {
+					t.Errorf("expected last update to be W=3, got %v", lastW)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			finished := make(chan struct{})
+			sub := realtime.Subscribe(context.Background(), sendAll(finished, nil, tc.send...), 123,
+				&realtime.SubscribeOptions{Buffer: tc.buffer, Overflow: tc.policy})
+			<-finished // don't consume anything until the stream is done
+			var got []realtime.Message
+			for m := range sub.C {
+				got = append(got, m)
+			}
+			if err := sub.Err(); err != nil {
+				t.Error("unexpected error:", err)
+			}
+			tc.check(t, got)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package sense
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dnesting/sense/internal/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy controls how requests to the Sense API are retried when the
+// server is overloaded (429) or temporarily unavailable (502, 503, 504), or
+// when the request fails because of a transient network error, such as a
+// refused or reset connection or a timeout.
+//
+// Only idempotent requests (GET, HEAD, OPTIONS, PUT, and DELETE) are retried.
+// In particular, authentication requests are never retried, since an MFA
+// code can only be used once.
+//
+// The delay before each retry grows exponentially.  If the server includes
+// a Retry-After header, the delay will be at least that long.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// If zero, 3 is used.
+	MaxAttempts int
+	// Initial is the delay before the first retry.  If zero, 500ms is used.
+	Initial time.Duration
+	// Max is the longest delay between attempts.  If zero, 30 seconds is
+	// used.  If the server asks us to wait longer than this, the request
+	// is not retried, and the error will include the requested delay (see
+	// [APIError.RetryAfter]).
+	Max time.Duration
+	// Multiplier is applied to the delay after each failed attempt.
+	// If less than 1, 2 is used.
+	Multiplier float64
+	// Jitter is the fraction (0 to 1) by which each delay is randomized.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is a reasonable retry policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Initial:     500 * time.Millisecond,
+	Max:         30 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+}
+
+// WithRetry causes requests to the Sense API to be retried according to
+// policy.  Use [DefaultRetryPolicy] for a reasonable default.  Without this
+// option, requests are not retried.
+//
+// This does not affect [Client.Stream]; see [WithReconnect] for that.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *newOptions) {
+		o.retry = &policy
+	}
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.Max <= 0 {
+		return 30 * time.Second
+	}
+	return p.Max
+}
+
+// delay returns the duration to wait before the given retry (starting at 1).
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	initial := p.Initial
+	if initial <= 0 {
+		initial = 500 * time.Millisecond
+	}
+	maxDelay := p.maxDelay()
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+	d := float64(initial) * math.Pow(mult, float64(retry-1))
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	return time.Duration(d)
+}
+
+// retryable returns true if req may safely be sent more than once.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if strings.HasSuffix(req.URL.Path, "/authenticate") {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryStatus returns true if a response with this status code is worth retrying.
+func retryStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// shouldRetry returns true if a request that resulted in res or err is
+// worth retrying.
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return transient(err)
+	}
+	return retryStatus(res.StatusCode)
+}
+
+// transient returns true if err looks like a temporary network problem,
+// such as a refused or reset connection or a timeout.  Other failures, like
+// TLS verification errors or errors from token renewal, would just fail
+// again.
+func transient(err error) bool {
+	// Every error from http.Client.Do is a *url.Error, which is itself
+	// a net.Error, so look at what it wraps.
+	for {
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			break
+		}
+		err = urlErr.Err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read") {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func addRetry(base *http.Client, policy RetryPolicy, log *slog.Logger) *http.Client {
+	return &http.Client{
+		Transport: &retryHttpTransport{
+			policy: policy,
+			base:   base,
+			log:    log,
+		},
+	}
+}
+
+type retryHttpTransport struct {
+	policy RetryPolicy
+	base   *http.Client
+	log    *slog.Logger // nil to use the default
+}
+
+func (t *retryHttpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.base.Do(req)
+	}
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	maxAttempts := t.policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := t.base.Do(req)
+		if attempt >= maxAttempts || ctx.Err() != nil || !shouldRetry(res, err) {
+			span.SetAttributes(attribute.Int("http.attempts", attempt))
+			return res, err
+		}
+
+		delay := t.policy.delay(attempt)
+		attrs := []attribute.KeyValue{attribute.Int("attempt", attempt)}
+		if err != nil {
+			attrs = append(attrs, attribute.String("error", err.Error()))
+		} else {
+			attrs = append(attrs, attribute.Int("http.status_code", res.StatusCode))
+			if after := client.ParseRetryAfter(res.Header.Get("Retry-After"), time.Now()); after > delay {
+				if after > t.policy.maxDelay() {
+					// We aren't willing to wait that long, so let the
+					// caller see the response.
+					span.SetAttributes(attribute.Int("http.attempts", attempt))
+					return res, nil
+				}
+				delay = after
+			}
+		}
+		attrs = append(attrs, attribute.String("delay", delay.String()))
+		span.AddEvent("retry", trace.WithAttributes(attrs...))
+		logger(t.log).Debug("sense: retrying request",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay))
+
+		if res != nil {
+			// Drain a little so the connection can be re-used.
+			io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
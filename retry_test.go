@@ -0,0 +1,218 @@
+package sense_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnesting/sense"
+	"golang.org/x/oauth2"
+)
+
+// flakyServer responds to each request with the next status in statuses,
+// and 200 once they run out.  It records each request body.
+type flakyServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	statuses   []int
+	retryAfter string
+	bodies     []string
+}
+
+func newFlakyServer(statuses ...int) *flakyServer {
+	s := &flakyServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, string(body))
+		if len(s.statuses) > 0 {
+			code := s.statuses[0]
+			s.statuses = s.statuses[1:]
+			if s.retryAfter != "" {
+				w.Header().Set("Retry-After", s.retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			io.WriteString(w, `{"status":"error","error_reason":"try again"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"devices":[]}`)
+	}))
+	return s
+}
+
+func (s *flakyServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+var testRetryPolicy = sense.RetryPolicy{
+	MaxAttempts: 3,
+	Initial:     time.Millisecond,
+	Max:         10 * time.Millisecond,
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlakyServer(503, 429)
+	defer srv.Close()
+	client := sense.New(sense.WithApiUrl(srv.URL, ""), sense.WithRetry(testRetryPolicy))
+
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlakyServer(503, 503, 503, 503)
+	defer srv.Close()
+	client := sense.New(sense.WithApiUrl(srv.URL, ""), sense.WithRetry(testRetryPolicy))
+
+	_, err := client.GetDevices(ctx, 123, false)
+	var apiErr *sense.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 {
+		t.Errorf("expected APIError with 503, got %v", err)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlakyServer(429)
+	srv.retryAfter = "60"
+	defer srv.Close()
+	client := sense.New(sense.WithApiUrl(srv.URL, ""), sense.WithRetry(testRetryPolicy))
+
+	_, err := client.GetDevices(ctx, 123, false)
+	var apiErr *sense.APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+		t.Errorf("expected APIError with RetryAfter 1m, got %v", err)
+	}
+	if n := srv.requests(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlakyServer(503)
+	defer srv.Close()
+
+	// Resume a stored session so the client is authenticated without
+	// talking to the fake server.
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	if err := store.Save(ctx, &sense.Session{
+		Email:  "test@example.com",
+		Token:  &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)},
+		UserID: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{Email: "test@example.com"},
+		sense.WithApiUrl(srv.URL, ""), sense.WithRetry(testRetryPolicy), sense.WithTokenStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake server's response isn't valid for this call, but we only
+	// care about what was sent.
+	client.UpdateNotificationSettings(ctx, 123, sense.NotificationSettings{NewPeakPush: true})
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.bodies) != 2 || srv.bodies[0] != srv.bodies[1] || !strings.Contains(srv.bodies[1], "new_peak_push") {
+		t.Errorf("expected the same body to be sent twice, got %q", srv.bodies)
+	}
+}
+
+func TestRetryNotAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlakyServer(503, 503, 503)
+	defer srv.Close()
+
+	_, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+		MfaFn: func(context.Context) (string, error) {
+			return "123456", nil
+		},
+	}, sense.WithApiUrl(srv.URL, ""), sense.WithRetry(testRetryPolicy))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n := srv.requests(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+// countingTransport counts the requests it sends.
+type countingTransport struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (t *countingTransport) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// A server whose certificate we don't trust will fail the same way
+	// every time, so shouldn't be retried.
+	untrusted := httptest.NewUnstartedServer(http.NotFoundHandler())
+	untrusted.Config.ErrorLog = log.New(io.Discard, "", 0)
+	untrusted.StartTLS()
+	defer untrusted.Close()
+	// Nothing is listening here, which is worth retrying.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, tt := range []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"untrusted certificate", untrusted.URL, 1},
+		{"connection refused", closed.URL, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &countingTransport{}
+			client := sense.New(
+				sense.WithApiUrl(tt.url, ""),
+				sense.WithHttpClient(&http.Client{Transport: transport}),
+				sense.WithRetry(testRetryPolicy))
+			if _, err := client.GetDevices(ctx, 123, false); err == nil {
+				t.Fatal("expected error")
+			}
+			if n := transport.count(); n != tt.want {
+				t.Errorf("expected %d attempts, got %d", tt.want, n)
+			}
+		})
+	}
+}
@@ -7,20 +7,24 @@ package sense
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dnesting/sense/internal/client"
-	"github.com/dnesting/sense/internal/ratelimited"
+	"github.com/dnesting/sense/ratelimited"
 	"github.com/dnesting/sense/senseauth"
 	"go.opentelemetry.io/otel"
+	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 )
 
 const (
 	defaultApiRoot   = "https://api.sense.com/apiservice/api/v1/"
-	defaultRateLimit = rate.Limit(time.Second / 10) // arbitrarily chosen
+	defaultRateLimit = rate.Limit(10) // per second, arbitrarily chosen
 	userAgent        = "go-sense-library (github.com/dnesting/sense)"
 	traceName        = "github.com/dnesting/sense"
 )
@@ -28,37 +32,73 @@ const (
 // Client is the primary high-level object used to interact with the Sense API.
 // It represents an "account", which can have some number of Monitors.
 // Instantiate a Client using [New] or [Connect].
+//
+// A Client is safe for concurrent use.  If it is re-authenticated while
+// other calls are in progress, those calls finish using the old credentials.
 type Client struct {
-	// Account fields are set after successful authentication.
-	userID    int
-	accountID int
-	monitors  []Monitor
+	// authMu serializes Authenticate and Logout.
+	authMu sync.Mutex
+	// mu serializes changes to state.  The state is replaced as a whole,
+	// never modified, so readers just Load it.
+	mu    sync.Mutex
+	state atomic.Pointer[clientState]
+
+	opt newOptions
+}
 
+// clientState is everything that changes when a Client authenticates.
+type clientState struct {
 	client         internalClient
 	realtimeClient internalRealtimeClient
-	opt            newOptions
+	tokenSrc       *senseauth.TokenSource // nil if unauthenticated
+
+	// session holds the account details and the most recent token,
+	// or nil if unauthenticated.
+	session *Session
+}
+
+// current returns the client's current state.
+func (c *Client) current() *clientState {
+	return c.state.Load()
+}
+
+// setState replaces the client's state.
+func (c *Client) setState(st *clientState) {
+	c.mu.Lock()
+	c.state.Store(st)
+	c.mu.Unlock()
+}
+
+// userID returns the user ID for this state, or 0 if unauthenticated.
+func (st *clientState) userID() int {
+	if st.session == nil {
+		return 0
+	}
+	return st.session.UserID
+}
+
+// getSession returns the current session, or an empty one if the client
+// is unauthenticated.
+func (c *Client) getSession() *Session {
+	if sess := c.current().session; sess != nil {
+		return sess
+	}
+	return &Session{}
 }
 
 // GetUserID returns the user ID associated with this client.
 func (c *Client) GetUserID() int {
-	return c.userID
+	return c.getSession().UserID
 }
 
 // GetAccountID returns the account ID associated with this client.
 func (c *Client) GetAccountID() int {
-	return c.accountID
+	return c.getSession().AccountID
 }
 
 // GetMonitors returns the monitors associated with this client.
 func (c *Client) GetMonitors() []Monitor {
-	return c.monitors
-}
-
-// Monitor is a Sense monitor, which is a physical device that measures power usage.
-// One account can have multiple Monitors.
-type Monitor struct {
-	ID           int
-	SerialNumber string
+	return append([]Monitor(nil), c.getSession().Monitors...)
 }
 
 // PasswordCredentials holds the credentials used to authenticate to the Sense API.
@@ -75,8 +115,21 @@ type PasswordCredentials struct {
 
 func (u PasswordCredentials) internalOnly() {}
 
+// TokenCredentials holds previously-issued tokens used to authenticate to
+// the Sense API without a password, such as those from an earlier [Session].
+//
+// UserID is required, since Sense needs it to renew tokens.  If AccessToken
+// is empty or expired, RefreshToken is used to obtain a new one.
+type TokenCredentials struct {
+	AccessToken  string
+	RefreshToken string
+	UserID       int
+}
+
+func (u TokenCredentials) internalOnly() {}
+
 // Credentials holds the credentials used to authenticate to the Sense API.
-// The only implementation of this is [PasswordCredentials].
+// The implementations of this are [PasswordCredentials] and [TokenCredentials].
 type Credentials interface {
 	internalOnly()
 }
@@ -84,6 +137,7 @@ type Credentials interface {
 var (
 	_ senseauth.PasswordCredentials = senseauth.PasswordCredentials(PasswordCredentials{})
 	_ Credentials                   = &PasswordCredentials{}
+	_ Credentials                   = &TokenCredentials{}
 )
 
 // Deprecated: For use with testing.
@@ -103,11 +157,46 @@ func New(opts ...Option) *Client {
 
 func newClient(opt *newOptions) (cl *Client) {
 	cl = &Client{opt: *opt}
-	cl.client = newInternalClient(opt)
-	cl.realtimeClient = newRealtimeClient(opt, nil)
+	// Create the limiter once, so that it survives re-authentication.
+	if cl.opt.limiter == nil {
+		cl.opt.limiter = newLimiter(opt.rateLimit)
+	}
+	if fs, ok := cl.opt.tokenStore.(*FileTokenStore); ok && fs.Logger == nil && cl.opt.logger != nil {
+		// Use a copy, since the store may be shared with other clients.
+		withLogger := *fs
+		withLogger.Logger = cl.opt.logger
+		cl.opt.tokenStore = &withLogger
+	}
+	cl.state.Store(cl.unauthenticated())
 	return cl
 }
 
+// unauthenticated returns a new unauthenticated state.
+func (s *Client) unauthenticated() *clientState {
+	return &clientState{
+		client:         newInternalClient(&s.opt),
+		realtimeClient: newRealtimeClient(&s.opt, nil),
+	}
+}
+
+// newLimiter returns a limiter for the given rate, or the default if rl is
+// nil.  It returns nil if the rate is 0.
+func newLimiter(rl *rate.Limit) ratelimited.Limiter {
+	limit := defaultRateLimit
+	if rl != nil {
+		limit = *rl
+	}
+	if limit == 0 {
+		return nil
+	}
+	// Allow a burst of up to one second's worth of requests.
+	burst := int(limit)
+	if burst < 1 {
+		burst = 1
+	}
+	return ratelimited.New(limit, burst)
+}
+
 // newInternalClient constructs a new [client.Client] from the provided options.
 // Most of the handling for options occurs here.
 func newInternalClient(opt *newOptions) (cl internalClient) {
@@ -126,19 +215,14 @@ func newInternalClient(opt *newOptions) (cl internalClient) {
 
 	var httpClient = opt.httpClient
 
-	// Apply rate-limiting, unless the user set a rate limit of 0.
-	var rl rate.Limit
-	if opt.rateLimit == nil {
-		rl = defaultRateLimit
-	} else if *opt.rateLimit != 0 {
-		rl = *opt.rateLimit
+	httpClient = addInstrumentation(httpClient, opt.apiUrl, opt.logger)
+	if opt.limiter != nil || len(opt.opLimits) > 0 {
+		httpClient = ratelimited.NewClientWithPaths(httpClient, opt.limiter, opt.opLimits)
 	}
-	burst := time.Second / time.Duration(rl)
-	if burst < 1 {
-		burst = 1
-	}
-	if rl != 0 {
-		httpClient = ratelimited.NewClient(httpClient, rate.NewLimiter(rl, int(burst)).Wait)
+	// Retries happen outside of rate limiting, so each attempt is
+	// subject to it.
+	if opt.retry != nil {
+		httpClient = addRetry(httpClient, *opt.retry, opt.logger)
 	}
 	headers := map[string]string{
 		"User-Agent": userAgent,
@@ -197,11 +281,30 @@ func Connect(ctx context.Context, creds Credentials, opts ...Option) (*Client, e
 // Test for this using errors.Is(err, sense.ErrAuthenticationNeeded).
 var ErrAuthenticationNeeded = client.ErrAuthenticationNeeded
 
+// APIError is returned when the Sense API responds with an unexpected
+// status code.  Retrieve it with errors.As to examine the status code and
+// the reason given by the server:
+//
+//	var apiErr *sense.APIError
+//	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+//		time.Sleep(apiErr.RetryAfter)
+//	}
+type APIError = client.APIError
+
 // Authenticate authenticates the client using the provided credentials.
 // If the client was previously authenticated (including with Connect),
 // those credentials will be replaced.
 // If creds is nil, the client will be unauthenticated.
 //
+// If the client was created with [WithTokenStore], a stored session will be
+// resumed if possible, and [PasswordCredentials] will be used only if that
+// fails.  After successfully authenticating with credentials, the new
+// session is saved to the store.
+//
+// Calls already in progress when Authenticate is called complete using the
+// previous credentials.  If authentication fails, the client is left
+// unauthenticated.
+//
 // See the [senseauth] package if you need more direct control over how
 // the user is authenticated.  This package can generate an HTTP client
 // that you can use here with [WithHttpClient].
@@ -209,53 +312,328 @@ func (s *Client) Authenticate(ctx context.Context, creds Credentials) error {
 	ctx, span := otel.Tracer(traceName).Start(ctx, "Authenticate")
 	defer span.End()
 
-	// reset to unauthenticated state
-	s.client = newInternalClient(&s.opt)
-	s.realtimeClient = newRealtimeClient(&s.opt, nil)
-	s.userID = 0
-	s.accountID = 0
-	s.monitors = nil
-	if creds == nil {
-		return nil
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	// Authentication requests use a fresh unauthenticated state, which
+	// also becomes the client's state if authentication fails.
+	base := s.unauthenticated()
+	var (
+		sess *Session
+		err  error
+	)
+	switch c := creds.(type) {
+	case *PasswordCredentials:
+		sess, err = s.authenticatePassword(ctx, base, *c)
+	case PasswordCredentials:
+		sess, err = s.authenticatePassword(ctx, base, c)
+	case *TokenCredentials:
+		sess, err = s.authenticateToken(ctx, base, *c)
+	case TokenCredentials:
+		sess, err = s.authenticateToken(ctx, base, c)
+	}
+	if err != nil || sess == nil {
+		s.setState(base)
+		return err
+	}
+	s.setState(s.authenticated(base, sess))
+
+	if s.opt.tokenStore != nil {
+		if err := s.opt.tokenStore.Save(ctx, sess); err != nil {
+			// We're authenticated, so don't fail, but make some noise.
+			err = fmt.Errorf("sense: save session: %w", err)
+			s.log().Warn(err.Error())
+			span.RecordError(err)
+		}
+	}
+	return nil
+}
+
+// Logout ends the client's session with Sense, so that its tokens can no
+// longer be used, and clears any session saved with [WithTokenStore].
+// The client is left unauthenticated, as if by Authenticate(ctx, nil), even
+// if an error is returned.
+func (s *Client) Logout(ctx context.Context) error {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "Logout")
+	defer span.End()
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	st := s.current()
+	base := s.unauthenticated()
+	s.setState(base)
+
+	var errs []error
+	if st.tokenSrc != nil {
+		tok, err := st.tokenSrc.TokenContext(ctx)
+		if err == nil {
+			err = s.authConfig(base).Revoke(ctx, tok)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sense: logout: %w", err))
+		}
+	}
+	if s.opt.tokenStore != nil {
+		if err := s.opt.tokenStore.Clear(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("sense: clear session: %w", err))
+		}
 	}
 
-	if _, ok := creds.(*PasswordCredentials); ok {
-		creds = *(creds.(*PasswordCredentials))
+	err := errors.Join(errs...)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// Refresh fetches the current account details and monitor list from Sense,
+// without re-authenticating, and updates the client to match.  It returns
+// the monitors that were added and removed since the client was last
+// updated.  If the client is re-authenticated as a different user while
+// Refresh is running, the client is left alone and an error is returned.
+func (s *Client) Refresh(ctx context.Context) (added, removed []Monitor, err error) {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "Refresh")
+	defer span.End()
+
+	st := s.current()
+	userID := st.userID()
+	if userID == 0 {
+		return nil, nil, fmt.Errorf("sense: refresh: %w", ErrAuthenticationNeeded)
+	}
+	res, err1 := st.client.GetUserWithResponse(ctx, userID)
+	if err := client.Ensure(err1, "GetUser", res, 200); err != nil {
+		span.RecordError(err)
+		return nil, nil, fmt.Errorf("sense: refresh: %w", err)
+	}
+	fresh := sessionFromHello(s.log(), res.JSON200, nil)
+
+	userChanged := false
+	updated := s.updateSession(ctx, func(_ *clientState, sess *Session) bool {
+		if sess.UserID != userID {
+			// Re-authenticated as someone else in the meantime.
+			userChanged = true
+			return false
+		}
+		added, removed = diffMonitors(sess.Monitors, fresh.Monitors)
+		sess.AccountID = fresh.AccountID
+		sess.Monitors = fresh.Monitors
+		return true
+	})
+	if updated == nil {
+		if userChanged {
+			err = errors.New("sense: refresh: user changed during refresh")
+		} else {
+			// Logged out in the meantime.
+			err = fmt.Errorf("sense: refresh: %w", ErrAuthenticationNeeded)
+		}
+		span.RecordError(err)
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// diffMonitors returns the monitors in b but not a, and those in a but not b.
+func diffMonitors(a, b []Monitor) (added, removed []Monitor) {
+	ids := func(ms []Monitor) map[int]bool {
+		m := make(map[int]bool, len(ms))
+		for _, mon := range ms {
+			m[mon.ID] = true
+		}
+		return m
+	}
+	inA, inB := ids(a), ids(b)
+	for _, m := range b {
+		if !inA[m.ID] {
+			added = append(added, m)
+		}
+	}
+	for _, m := range a {
+		if !inB[m.ID] {
+			removed = append(removed, m)
+		}
+	}
+	return added, removed
+}
+
+// authenticatePassword authenticates using an email and password, unless
+// a stored session for the same user can be resumed.
+func (s *Client) authenticatePassword(ctx context.Context, base *clientState, creds PasswordCredentials) (*Session, error) {
+	if s.opt.tokenStore != nil {
+		sess, err := s.restoreSession(ctx, base, creds.Email)
+		if err == nil {
+			return sess, nil
+		}
+		s.log().Debug("sense: unable to resume stored session", slog.Any("error", err))
 	}
 
 	// The meat of authentication is handled by the senseauth package.
-	screds := senseauth.PasswordCredentials(creds.(PasswordCredentials))
-	config := senseauth.DefaultConfig
-	config.InternalSenseClient = s.client // use our client in case it was customized
+	screds := senseauth.PasswordCredentials(creds)
+	config := s.authConfig(base)
 	tok, httpResponse, err := config.PasswordCredentialsToken(ctx, screds)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var hello client.Hello
 	if err := json.NewDecoder(httpResponse.Body).Decode(&hello); err != nil {
-		return fmt.Errorf("sense: authenticate: parse response: %w", err)
+		return nil, fmt.Errorf("sense: authenticate: parse response: %w", err)
+	}
+	sess := sessionFromHello(s.log(), &hello, tok)
+	sess.Email = creds.Email
+	return sess, nil
+}
+
+// authenticateToken renews the token in creds if needed, and then fetches
+// the account details that would otherwise have come from the password login.
+func (s *Client) authenticateToken(ctx context.Context, base *clientState, creds TokenCredentials) (*Session, error) {
+	if creds.UserID == 0 {
+		return nil, errors.New("sense: authenticate: token credentials have no user ID")
+	}
+	if creds.AccessToken == "" && creds.RefreshToken == "" {
+		return nil, errors.New("sense: authenticate: token credentials have no tokens")
+	}
+
+	config := s.authConfig(base)
+	tokenSrc := config.TokenSource(senseauth.NewToken(creds.AccessToken, creds.RefreshToken, creds.UserID))
+	tok, err := tokenSrc.TokenContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token was just checked, so we don't need renewals for this.
+	opt := s.opt
+	opt.httpClient = senseauth.NewClientFrom(opt.httpClient, oauth2.StaticTokenSource(tok))
+	res, err1 := newInternalClient(&opt).GetUserWithResponse(ctx, creds.UserID)
+	if err := client.Ensure(err1, "GetUser", res, 200); err != nil {
+		return nil, fmt.Errorf("sense: authenticate: %w", err)
+	}
+	sess := sessionFromHello(s.log(), res.JSON200, tok)
+	sess.UserID = creds.UserID
+	return sess, nil
+}
+
+// sessionFromHello builds a Session from the account details returned by
+// the API along with tok.
+func sessionFromHello(log *slog.Logger, hello *client.Hello, tok *oauth2.Token) *Session {
+	sess := &Session{
+		Token:     tok,
+		UserID:    deref(hello.UserId),
+		AccountID: deref(hello.AccountId),
+	}
+	if sess.UserID == 0 {
+		sess.UserID = senseauth.UserID(tok)
+	}
+	for _, m := range deref(hello.Monitors) {
+		sess.Monitors = append(sess.Monitors, monitorFromClient(log, m))
+	}
+	return sess
+}
+
+// errNoSession indicates the token store had no session to resume.
+var errNoSession = errors.New("no stored session")
+
+// restoreSession attempts to resume a session from the token store,
+// renewing its token if needed.  If email is non-empty, the stored session
+// must belong to the same user.
+func (s *Client) restoreSession(ctx context.Context, base *clientState, email string) (*Session, error) {
+	sess, err := s.opt.tokenStore.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.Token == nil {
+		return nil, errNoSession
+	}
+	if email != "" && sess.Email != email {
+		return nil, fmt.Errorf("stored session is for %q, not %q", sess.Email, email)
+	}
+
+	if sess.UserID == 0 {
+		return nil, errors.New("stored session has no user ID")
+	}
+
+	// Make sure the token is still usable, renewing it if necessary.
+	config := s.authConfig(base)
+	tokenSrc := config.TokenSourceForUser(sess.Token, sess.UserID)
+	tok, err := tokenSrc.TokenContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken != sess.Token.AccessToken {
+		renewed := *sess
+		renewed.Token = tok
+		sess = &renewed
+	}
+	s.log().Debug("sense: resumed stored session", slog.Int("user_id", sess.UserID))
+	return sess, nil
+}
+
+// authConfig returns the senseauth configuration used to authenticate
+// and renew tokens using the (unauthenticated) client in base.
+func (s *Client) authConfig(base *clientState) senseauth.Config {
+	config := senseauth.DefaultConfig
+	config.InternalSenseClient = base.client // use our client in case it was customized
+	config.Logger = s.opt.logger
+	return config
+}
+
+// authenticated returns a new state with authenticated clients built from
+// sess.  Renewed tokens will be saved to the session.
+func (s *Client) authenticated(base *clientState, sess *Session) *clientState {
+	config := s.authConfig(base)
+	var tokenSrc *senseauth.TokenSource
+	config.OnRenew = func(tok *oauth2.Token) {
+		// Ignore renewals by a token source we're no longer using.
+		s.updateSession(context.Background(), func(cur *clientState, sess *Session) bool {
+			if cur.tokenSrc != tokenSrc {
+				return false
+			}
+			sess.Token = tok
+			return true
+		})
 	}
 
 	// We have an authentication token, so we can now build the HTTP client
 	// that we want our Sense client to use.
 	opt := s.opt // copy because we'll be overriding things we don't want to be persistent
-	tokenSrc := config.TokenSource(tok)
+	tokenSrc = config.TokenSourceForUser(sess.Token, sess.UserID)
 	opt.httpClient = senseauth.NewClientFrom(opt.httpClient, tokenSrc)
 
-	// Re-create the clients using this new authenticated HTTP client.
-	s.client = newInternalClient(&opt)
-	s.realtimeClient = newRealtimeClient(&opt, tokenSrc)
-
-	s.userID = deref(hello.UserId)
-	s.accountID = deref(hello.AccountId)
-	for _, m := range deref(hello.Monitors) {
-		s.monitors = append(s.monitors, Monitor{
-			ID:           deref(m.Id),
-			SerialNumber: deref(m.SerialNumber),
-		})
+	// Create new clients using this new authenticated HTTP client.
+	return &clientState{
+		client:         newInternalClient(&opt),
+		realtimeClient: newRealtimeClient(&opt, tokenSrc),
+		tokenSrc:       tokenSrc,
+		session:        sess,
 	}
+}
 
-	return nil
+// updateSession replaces the current session with a copy modified by fn,
+// and saves it to the token store if one is configured.  If fn returns
+// false, or the client is unauthenticated, nothing is changed.
+// The lock is held while fn runs.
+func (s *Client) updateSession(ctx context.Context, fn func(cur *clientState, sess *Session) bool) *Session {
+	s.mu.Lock()
+	cur := s.state.Load()
+	if cur.session == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	sess := *cur.session
+	if !fn(cur, &sess) {
+		s.mu.Unlock()
+		return nil
+	}
+	next := *cur
+	next.session = &sess
+	s.state.Store(&next)
+	s.mu.Unlock()
+
+	if s.opt.tokenStore != nil {
+		if err := s.opt.tokenStore.Save(ctx, &sess); err != nil {
+			s.log().Warn("sense: unable to save session", slog.Any("error", err))
+		}
+	}
+	return &sess
 }
 
 // deref accepts a pointer type and returns the dereferenced value,
@@ -1,11 +1,23 @@
 package sense_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/ratelimited"
+	"github.com/dnesting/sense/realtime"
+	"github.com/dnesting/sense/sensetest"
 )
 
 func TestClient(t *testing.T) {
@@ -25,6 +37,292 @@ func TestClient(t *testing.T) {
 	}
 }
 
+// testCreds authenticate to the account served by newTestServer.
+var testCreds = sense.PasswordCredentials{Email: "test@example.com", Password: "secret-password"}
+
+// testDateCreated is when the account served by newTestServer was created.
+var testDateCreated = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestServer returns a fake server with a single account that owns
+// monitor 123.  The monitor's real-time stream sends a hello and one
+// update, then closes.
+func newTestServer() *sensetest.Server {
+	return sensetest.NewServer(&sensetest.Account{
+		Email:       testCreds.Email,
+		Password:    testCreds.Password,
+		DateCreated: testDateCreated,
+		Monitors: []*sensetest.Monitor{{
+			ID: 123,
+			Realtime: []realtime.Message{
+				&realtime.Hello{Online: true},
+				&realtime.RealtimeUpdate{W: 590.5, Hz: 60, Voltage: []float32{120.5, 121}},
+			},
+			CloseRealtime: true,
+		}},
+	})
+}
+
+// connectTestClient returns a client authenticated to srv with testCreds.
+func connectTestClient(t *testing.T, srv *sensetest.Server, opts ...sense.Option) *sense.Client {
+	t.Helper()
+	client, err := sense.Connect(context.Background(), testCreds, append(srv.Options(), opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// TestConcurrentUse is mostly useful with the race detector.
+func TestConcurrentUse(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := connectTestClient(t, srv)
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*n)
+	for range n {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			errs <- client.Authenticate(ctx, testCreds)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.GetDevices(ctx, 123, false)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- client.Stream(ctx, 123, func(_ context.Context, msg realtime.Message) error {
+				if _, ok := msg.(*realtime.RealtimeUpdate); ok {
+					return realtime.Stop
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if client.GetUserID() == 0 || len(client.GetMonitors()) != 1 {
+		t.Errorf("expected client to remain authenticated")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Unauthenticated
+	_, err := sense.New(srv.Options()...).GetDevices(ctx, 123, false)
+	var apiErr *sense.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected APIError with 401, got %v", err)
+	}
+	if !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected %v to match ErrAuthenticationNeeded", err)
+	}
+
+	// Not found
+	_, err = connectTestClient(t, srv).GetDevices(ctx, 456, false)
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.Op != "GetDevices" || apiErr.StatusCode != http.StatusNotFound ||
+		apiErr.ServerStatus != "error" || apiErr.Reason != "Monitor not found" || len(apiErr.Body) == 0 {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+	if errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("404 should not match ErrAuthenticationNeeded")
+	}
+
+	// Rate limited
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	_, err = sense.New(sense.WithApiUrl(limited.URL, "")).GetDevices(ctx, 123, false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 30*time.Second {
+		t.Errorf("expected APIError with 429 and RetryAfter 30s, got %+v", apiErr)
+	}
+}
+
+func TestWithLimiter(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	counter := func(name string) ratelimited.Limiter {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			counts[name]++
+			return nil
+		}
+	}
+	opts := []sense.Option{
+		sense.WithLimiter(counter("all")),
+		sense.WithOperationLimit("/authenticate", counter("auth")),
+	}
+
+	// Two clients sharing the same limiters, one of which re-authenticates.
+	for range 2 {
+		client := connectTestClient(t, srv, opts...)
+		if _, err := client.GetDevices(ctx, 123, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Authenticate(ctx, testCreds); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetDevices(ctx, 123, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["all"] != 8 || counts["auth"] != 4 {
+		t.Errorf("expected 8 requests with 4 authentications, got %v", counts)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWithLogger(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	var logged, other syncBuffer
+	newLogger := func(w io.Writer) *slog.Logger {
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	client := connectTestClient(t, srv, sense.WithLogger(newLogger(&logged)))
+	// A second client shouldn't log to the first's logger.
+	connectTestClient(t, srv, sense.WithLogger(newLogger(&other)))
+	before := logged.String()
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+		return realtime.Stop
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := logged.String()
+	for _, want := range []string{
+		`msg="senseauth: authenticated" op=authenticate user_id=`,
+		`/monitors/123/devices/overview elapsed=`,
+		`msg="realtime: dialing" monitor_id=123`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "senseauth: authenticated") != 1 || strings.Contains(other.String(), "devices") {
+		t.Errorf("expected each client to log separately, got:\n%s\nand:\n%s", before, other.String())
+	}
+}
+
+func TestQuietByDefault(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	var defaultLog, debugLog syncBuffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&defaultLog, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(old)
+
+	// Enabling and then disabling debug logging should leave it off.
+	sense.SetDebug(log.New(&debugLog, "", 0), nil)
+	sense.SetDebug(nil, nil)
+
+	client := connectTestClient(t, srv)
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+		return realtime.Stop
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := defaultLog.String() + debugLog.String(); got != "" {
+		t.Errorf("expected nothing to be logged without a logger, got:\n%s", got)
+	}
+}
+
+func TestDebugRedaction(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	run := func() string {
+		var logged syncBuffer
+		httpClient := sense.SetDebug(log.New(&logged, "", 0), nil)
+		defer sense.SetDebug(nil, nil)
+		client := connectTestClient(t, srv, sense.WithHttpClient(httpClient))
+		if _, err := client.GetDevices(ctx, 123, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Stream(ctx, 123, func(context.Context, realtime.Message) error {
+			return realtime.Stop
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return logged.String()
+	}
+
+	got := run()
+	for _, secret := range []string{testCreds.Password, "t1.v2."} {
+		if strings.Contains(got, secret) {
+			t.Errorf("expected %q to be redacted, got:\n%s", secret, got)
+		}
+	}
+	for _, want := range []string{
+		"password=REDACTED",
+		`"access_token":"REDACTED"`,
+		"Authorization: Bearer REDACTED",
+		"access_token=REDACTED",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	sense.SetDebugRedaction(false)
+	defer sense.SetDebugRedaction(true)
+	if got := run(); !strings.Contains(got, testCreds.Password) {
+		t.Errorf("expected password to be logged with redaction disabled, got:\n%s", got)
+	}
+}
+
 func doSomethingWith(c *sense.Client) {}
 
 func ExampleConnect() {
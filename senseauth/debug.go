@@ -1,28 +1,38 @@
 package senseauth
 
 import (
-	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"sync/atomic"
 )
 
-var debugLogger *log.Logger
+var debugLogger atomic.Pointer[slog.Logger]
 
-func debugging() bool {
-	return debugLogger != nil
-}
+// discardLogger is used when no logger has been provided, so the library
+// stays quiet unless asked otherwise.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
 
-func debugf(format string, args ...interface{}) {
-	if debugging() {
-		debugLogger.Output(2, fmt.Sprintf(format, args...))
+// logger returns l, or if that is nil, the logger set with SetDebug,
+// or a logger that discards everything.
+func logger(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
 	}
-}
-
-func debug(args ...interface{}) {
-	if debugging() {
-		debugLogger.Output(2, fmt.Sprint(args...))
+	if l := debugLogger.Load(); l != nil {
+		return l
 	}
+	return discardLogger
 }
 
+// SetDebug enables debug logging using the given logger, for any Config
+// without its own Logger. Set to nil to disable.
+//
+// Deprecated: Set [Config.Logger] instead.
 func SetDebug(l *log.Logger) {
-	debugLogger = l
+	if l == nil {
+		debugLogger.Store(nil)
+		return
+	}
+	debugLogger.Store(slog.New(slog.NewTextHandler(l.Writer(), &slog.HandlerOptions{Level: slog.LevelDebug})))
 }
@@ -0,0 +1,18 @@
+package senseauth
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// renewals counts token renewals, with an "outcome" attribute of "success"
+// or "failure".
+var renewals = func() metric.Int64Counter {
+	c, err := otel.Meter(traceName).Int64Counter("sense.auth.renewals",
+		metric.WithDescription("Token renewals, by outcome"),
+		metric.WithUnit("{renewal}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return c
+}()
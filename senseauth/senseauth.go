@@ -22,21 +22,21 @@ package senseauth
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"path/filepath"
-	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dnesting/sense/internal/client"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/oauth2"
 )
 
@@ -56,6 +56,22 @@ type Config struct {
 
 	// InternalSenseClient is used internally.
 	InternalSenseClient internalClient
+
+	// OnRenew, if set, is called with each new token obtained by a
+	// TokenSource created from this Config.  This can be used to persist
+	// renewed tokens.
+	OnRenew func(*oauth2.Token)
+
+	// RefreshAhead, if positive, causes a TokenSource to renew tokens once
+	// they are within this long of expiring, rather than waiting until they
+	// have expired.  If an early renewal fails, the existing token continues
+	// to be used until it expires, and another early renewal isn't attempted
+	// for a minute.
+	RefreshAhead time.Duration
+
+	// Logger receives log records for authentication and renewals.  If nil,
+	// the logger set with SetDebug is used, if any.
+	Logger *slog.Logger
 }
 
 var defaultApiUrl = "https://api.sense.com/apiservice/api/v1"
@@ -77,6 +93,15 @@ func (c Config) http() *http.Client {
 // ErrMFANeeded indicates that MFA is needed to authenticate but no MFA func was provided.
 var ErrMFANeeded = errors.New("senseauth: MFA needed")
 
+// ErrTokenMissingUserID indicates that a token needs to be renewed, but
+// the Sense user ID required to renew it is not known.  This happens with
+// tokens that were serialized (losing their Extra data) and not passed
+// through [WithUserID] or [Config.TokenSourceForUser].
+var ErrTokenMissingUserID = errors.New("senseauth: token has no user ID")
+
+// ErrNoToken indicates that a TokenSource was created without a token.
+var ErrNoToken = errors.New("senseauth: no token")
+
 // PasswordCredentials holds the credentials used to authenticate to the Sense API.
 //
 // MfaFn is an optional function that returns the MFA code.
@@ -97,19 +122,20 @@ func deref[T any](v *T) (result T) {
 	return *v
 }
 
-func (c *Config) getClient() internalClient {
+func (c *Config) getClient() (internalClient, error) {
 	cl := c.InternalSenseClient
 	if cl == nil {
 		var err error
 		// Use our own unauthenticated Sense client to perform the authentication requests.
-		cl, err = client.NewClientWithResponses(c.BaseURL, client.WithHTTPClient(c.http()))
+		cl, err = client.NewClientWithResponses(c.BaseURL,
+			client.WithBaseURL(c.BaseURL), // validates it
+			client.WithHTTPClient(c.http()))
 		if err != nil {
-			// shouldn't happen
-			panic("senseauth: failed to create internal client: " + err.Error())
+			return nil, fmt.Errorf("senseauth: create client: %w", err)
 		}
 		c.InternalSenseClient = cl
 	}
-	return cl
+	return cl, nil
 }
 
 const traceName = "github.com/dnesting/sense/senseauth"
@@ -125,17 +151,20 @@ const traceName = "github.com/dnesting/sense/senseauth"
 func (c Config) PasswordCredentialsToken(ctx context.Context, creds PasswordCredentials) (tok *oauth2.Token, httpResponse *http.Response, err error) {
 	ctx, span := otel.Tracer(traceName).Start(ctx, "PasswordCredentialsToken")
 	defer span.End()
-	if debugging() {
-		defer func() {
-			if err != nil {
-				debug(err)
-			} else {
-				debug("senseauth: auth successful:", tok)
-			}
-		}()
-	}
+	log := logger(c.Logger).With(slog.String("op", "authenticate"))
+	defer func() {
+		if err != nil {
+			log.Debug("senseauth: authentication failed", slog.Any("error", err))
+		} else {
+			log.Debug("senseauth: authenticated", slog.Int("user_id", UserID(tok)))
+		}
+	}()
 
-	cl := c.getClient()
+	cl, err := c.getClient()
+	if err != nil {
+		span.RecordError(err)
+		return nil, nil, err
+	}
 	request := client.AuthenticateFormdataRequestBody{
 		Email:    &creds.Email,
 		Password: &creds.Password,
@@ -166,7 +195,7 @@ func (c Config) PasswordCredentialsToken(ctx context.Context, creds PasswordCred
 				span.RecordError(err)
 				return err
 			}
-			debug("senseauth: calling MFA function")
+			log.Debug("senseauth: calling MFA function")
 			mfaValue, err := creds.MfaFn(ctx)
 			if err != nil {
 				err = fmt.Errorf("senseauth: mfa: %w", err)
@@ -181,6 +210,9 @@ func (c Config) PasswordCredentialsToken(ctx context.Context, creds PasswordCred
 				span.RecordError(err)
 				return err
 			}
+			// Return this response rather than the MFA challenge.
+			httpResponse = res.HTTPResponse
+			body = res.Body
 			return nil
 		}()
 		if err != nil {
@@ -203,7 +235,7 @@ func (c Config) PasswordCredentialsToken(ctx context.Context, creds PasswordCred
 	tok = &oauth2.Token{
 		AccessToken:  deref(data.AccessToken),
 		RefreshToken: deref(data.RefreshToken),
-		Expiry:       guessExpiry(deref(data.AccessToken)),
+		Expiry:       guessExpiry(log, deref(data.AccessToken)),
 	}
 	return withExtras(tok, deref(data.UserId)), httpResponse, nil
 }
@@ -211,38 +243,113 @@ func (c Config) PasswordCredentialsToken(ctx context.Context, creds PasswordCred
 const senseUserIdKey = "github.com/dnesting/sense/senseauth/sense_user_id"
 
 func withExtras(tok *oauth2.Token, userID int) *oauth2.Token {
-	debugf("senseauth: caching user ID %d with token", userID)
 	return tok.WithExtra(map[string]interface{}{
 		senseUserIdKey: userID,
 	})
 }
 
+// WithUserID returns a copy of tok that carries the given Sense user ID,
+// which is required to renew it.  PasswordCredentialsToken does this
+// automatically, but the user ID is lost if the token is serialized, so
+// use this (or [Config.TokenSourceForUser]) to restore it when loading a
+// token from storage.
+func WithUserID(tok *oauth2.Token, userID int) *oauth2.Token {
+	return withExtras(tok, userID)
+}
+
+// NewToken returns a token built from a previously-issued access token,
+// refresh token, and user ID, suitable for use with [Config.TokenSource].
+// If the expiry can't be determined from the access token (or it is empty),
+// the token is treated as expired so that it will be renewed on first use.
+func NewToken(accessToken, refreshToken string, userID int) *oauth2.Token {
+	tok := &oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expiry:       time.Now(),
+	}
+	if info, err := ParseToken(accessToken); err == nil && !info.Expiry.IsZero() {
+		tok.Expiry = info.Expiry
+	}
+	return withExtras(tok, userID)
+}
+
+// UserID returns the Sense user ID carried by tok, or 0 if there is none.
+func UserID(tok *oauth2.Token) int {
+	return fromExtras(tok)
+}
+
 func fromExtras(tok *oauth2.Token) (userID int) {
 	if tok != nil {
 		if userID, ok := tok.Extra(senseUserIdKey).(int); ok {
-			debugf("senseauth: got user ID %d from token", userID)
 			return userID
 		}
 	}
-	debugf("senseauth: no user ID in token")
 	return 0
 }
 
+// Revoke ends the session associated with tok, so that neither its access
+// token nor its refresh token can be used again.  If the access token has
+// expired, it is renewed first, since Sense requires one to log out.
+func (c Config) Revoke(ctx context.Context, tok *oauth2.Token) error {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "Revoke")
+	defer span.End()
+
+	cl, err := c.getClient()
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if !tok.Valid() {
+		ts := c.TokenSource(tok)
+		ts.onRenew = nil // this token is about to be revoked
+		if tok, err = ts.TokenContext(ctx); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+	res, err1 := cl.LogoutWithResponse(ctx, func(_ context.Context, req *http.Request) error {
+		tok.SetAuthHeader(req)
+		return nil
+	})
+	if err := client.Ensure(err1, "Logout", res, 200); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("senseauth: %w", err)
+	}
+	logger(c.Logger).Debug("senseauth: token revoked", slog.String("op", "logout"))
+	return nil
+}
+
 // TokenSource returns a token source that will renew the token when needed.
 // The provided token must have been generated by the PasswordCredentialsToken method.
-// Renewals will use the HTTP client configured in the Config in a background context.
+// Renewals will use the HTTP client configured in the Config.
 func (c Config) TokenSource(tok *oauth2.Token) *TokenSource {
+	cl, err := c.getClient()
 	return &TokenSource{
-		tok:        tok,
-		baseUrl:    c.BaseURL,
-		httpClient: c.http(),
-		client:     c.getClient(),
+		tok:          tok,
+		baseUrl:      c.BaseURL,
+		httpClient:   c.http(),
+		client:       cl,
+		clientErr:    err,
+		onRenew:      c.OnRenew,
+		refreshAhead: c.RefreshAhead,
+		logger:       c.Logger,
+	}
+}
+
+// TokenSourceForUser is like TokenSource, but accepts any token along with the
+// Sense user ID needed to renew it.  Use this with tokens loaded from storage.
+// If userID is 0, any user ID already carried by tok is kept.
+func (c Config) TokenSourceForUser(tok *oauth2.Token, userID int) *TokenSource {
+	if tok != nil && userID != 0 {
+		tok = withExtras(tok, userID)
 	}
+	return c.TokenSource(tok)
 }
 
 // Client returns an HTTP client that will renew the token when needed.
 // The provided token must have been generated by the PasswordCredentialsToken method.
-// Renewals will use the HTTP client configured in the Config in a background context.
+// Renewals will use the HTTP client configured in the Config in the context of
+// the request that needed them.
 // The returned client will otherwise be unassociated with the HTTP client in the Config.
 func (c Config) Client(tok *oauth2.Token) *http.Client {
 	return c.ClientFrom(nil, tok)
@@ -251,30 +358,62 @@ func (c Config) Client(tok *oauth2.Token) *http.Client {
 // ClientFrom returns an HTTP client, derived from the provided client, that will
 // renew the token when needed.
 // The provided token must have been generated by the PasswordCredentialsToken method.
-// Renewals will use the HTTP client configured in the Config in a background context.
+// Renewals will use the HTTP client configured in the Config in the context of
+// the request that needed them.
 func (c Config) ClientFrom(cli *http.Client, tok *oauth2.Token) *http.Client {
 	return NewClientFrom(cli, c.TokenSource(tok))
 }
 
 // NewClientFrom returns an HTTP client, derived from the provided client, that
-// will renew the token when needed. Renewals will use the provided token source
-// in a background context.
+// will renew the token when needed.  If ts is a [*TokenSource], the client uses
+// a [Transport], so renewals use the context of the request that needed them.
+// Otherwise renewals will use the provided token source in a background context.
 func NewClientFrom(cli *http.Client, ts oauth2.TokenSource) *http.Client {
-	ctx := context.Background()
-	if cli != nil {
-		// This is how oauth2.NewClient gets the underlying Transport wrapped.
-		ctx = context.WithValue(ctx, oauth2.HTTPClient, cli)
+	src, ok := ts.(*TokenSource)
+	if !ok {
+		ctx := context.Background()
+		if cli != nil {
+			// This is how oauth2.NewClient gets the underlying Transport wrapped.
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, cli)
+		}
+		return oauth2.NewClient(ctx, ts)
+	}
+	if cli == nil {
+		cli = &http.Client{}
+	}
+	return &http.Client{
+		Transport:     &Transport{Source: src, Base: cli.Transport},
+		CheckRedirect: cli.CheckRedirect,
+		Jar:           cli.Jar,
+		Timeout:       cli.Timeout,
 	}
-	return oauth2.NewClient(ctx, ts)
 }
 
 // TokenSource is a token source that will renew the token when needed.
 // It can be used with standard golang.org/x/oauth2 types.
+// It is safe for concurrent use, and only one renewal will be in flight
+// at a time.
 type TokenSource struct {
-	tok        *oauth2.Token
-	baseUrl    string
-	httpClient *http.Client
-	client     internalClient
+	baseUrl      string
+	httpClient   *http.Client
+	client       internalClient
+	clientErr    error
+	onRenew      func(*oauth2.Token)
+	refreshAhead time.Duration
+	logger       *slog.Logger
+
+	mu          sync.Mutex
+	tok         *oauth2.Token
+	renewal     *renewal  // in-flight renewal, if any
+	earlyFailed time.Time // when an early renewal last failed
+}
+
+// renewal is a token renewal shared by all callers that need it.
+// tok and err are set before done is closed.
+type renewal struct {
+	done chan struct{}
+	tok  *oauth2.Token
+	err  error
 }
 
 var _ oauth2.TokenSource = (*TokenSource)(nil)
@@ -289,34 +428,139 @@ func ptr[T any](v T) *T {
 	return &v
 }
 
+// log returns the logger for this token source.
+func (t *TokenSource) log() *slog.Logger {
+	return logger(t.logger)
+}
+
+// earlyRetryDelay is how long to keep using a token after an early renewal
+// fails before trying again, so that an outage doesn't lead to a renewal
+// attempt for every request.
+const earlyRetryDelay = time.Minute
+
+// fresh reports whether the current token can be used without renewing it.
+// Callers must hold t.mu.
+func (t *TokenSource) fresh() bool {
+	if t.tok == nil || !t.tok.Valid() {
+		return false
+	}
+	if t.refreshAhead <= 0 || t.tok.Expiry.IsZero() || time.Until(t.tok.Expiry) > t.refreshAhead {
+		return true
+	}
+	return !t.earlyFailed.IsZero() && time.Since(t.earlyFailed) < earlyRetryDelay
+}
+
 // TokenContext returns a token, renewing it if needed using
-// the provided context.
+// the provided context.  If a renewal is already in progress, this waits
+// for its result instead of starting another.
+//
+// Since other callers may be waiting for the same renewal, cancelling ctx
+// only stops this call from waiting; the renewal itself carries on, bounded
+// by its own timeout.
+//
+// The standard oauth2 types will simply call Token(), without passing a
+// context (see https://github.com/golang/oauth2/issues/262).  Use [Transport]
+// to have the request context passed here.
 func (t *TokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
-	// Note: The standard oauth2 types will simply call Token(), without passing
-	// a context.  This capabililty is nevertheless here for completeness and
-	// future hopes.  We could implement our own HTTP transport that passes
-	// the request context here, but that's unnecessary work right now.
-	//
-	// See also: https://github.com/golang/oauth2/issues/262
-	_, file, line, _ := runtime.Caller(2)
-	file = filepath.Base(file)
-	if t.tok != nil && t.tok.Valid() {
-		debugf("senseauth: re-using existing valid token for %s:%d", file, line)
-		return t.tok, nil
-	}
-	userID := fromExtras(t.tok)
+	log := t.log()
+	if log.Enabled(ctx, slog.LevelDebug) {
+		_, file, line, _ := runtime.Caller(2)
+		log = log.With(slog.String("caller", fmt.Sprintf("%s:%d", filepath.Base(file), line)))
+	}
+
+	t.mu.Lock()
+	if t.fresh() {
+		tok := t.tok
+		t.mu.Unlock()
+		log.Debug("senseauth: re-using existing valid token")
+		return tok, nil
+	}
+	r := t.renewal
+	if r == nil {
+		r = &renewal{done: make(chan struct{})}
+		t.renewal = r
+		// The renewal is shared with other callers, so it shouldn't fail
+		// just because this caller gives up on it.
+		go t.runRenewal(context.WithoutCancel(ctx), log, r, t.tok)
+	} else {
+		log.Debug("senseauth: waiting for renewal in progress")
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if r.err != nil {
+		// If we were renewing early, the existing token is still good.
+		t.mu.Lock()
+		tok := t.tok
+		t.mu.Unlock()
+		if tok != nil && tok.Valid() {
+			log.Debug("senseauth: early renewal failed, using existing token", slog.Any("error", r.err))
+			return tok, nil
+		}
+		return nil, r.err
+	}
+	return r.tok, nil
+}
+
+// renewTimeout bounds how long a renewal may take, since it doesn't
+// inherit a deadline from any of the callers waiting for it.
+const renewTimeout = time.Minute
+
+// runRenewal performs renewal r of the token old, then makes the result
+// available to its callers.
+func (t *TokenSource) runRenewal(ctx context.Context, log *slog.Logger, r *renewal, old *oauth2.Token) {
+	ctx, cancel := context.WithTimeout(ctx, renewTimeout)
+	defer cancel()
+
+	r.tok, r.err = t.renew(ctx, old)
+	if r.err != nil {
+		renewals.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "failure")))
+		log.Debug("senseauth: renewal failed", slog.Any("error", r.err))
+	} else {
+		renewals.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "success")))
+		log.Debug("senseauth: renewed token", slog.Time("expiry", r.tok.Expiry))
+		if t.onRenew != nil {
+			t.onRenew(r.tok)
+		}
+	}
+	t.mu.Lock()
+	if r.err == nil {
+		t.tok = r.tok
+		t.earlyFailed = time.Time{}
+	} else if t.tok != nil && t.tok.Valid() {
+		t.earlyFailed = time.Now()
+	}
+	t.renewal = nil
+	t.mu.Unlock()
+	close(r.done)
+}
+
+// renew obtains a new token using the refresh token in old.
+func (t *TokenSource) renew(ctx context.Context, old *oauth2.Token) (*oauth2.Token, error) {
+	if old == nil {
+		return nil, ErrNoToken
+	}
+	userID := fromExtras(old)
 	if userID == 0 {
 		// The Sense OAuth implementation seems to require a user ID to accompany
 		// token renewals.  Since we don't want to connect this package to the main
 		// sense package (where this data value would live), we smuggle it in the
 		// token's extra data.  If it's not there, we can't renew the token.
-		panic("senseauth: token was not generated correctly")
+		return nil, ErrTokenMissingUserID
+	}
+	if t.clientErr != nil {
+		return nil, t.clientErr
 	}
 	ctx, span := otel.Tracer(traceName).Start(ctx, "Renew auth token")
 	defer span.End()
 	req := client.RenewAuthTokenFormdataRequestBody{
 		UserId:        &userID,
-		RefreshToken:  &t.tok.RefreshToken,
+		RefreshToken:  &old.RefreshToken,
 		IsAccessToken: ptr(true),
 	}
 	res, err1 := t.client.RenewAuthTokenWithFormdataBodyWithResponse(ctx, req)
@@ -326,49 +570,27 @@ func (t *TokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
 	}
 	data := res.JSON200
 
-	debugf("senseauth: successfully renewed token for %s:%d", file, line)
 	tok := &oauth2.Token{
 		AccessToken:  deref(data.AccessToken),
 		RefreshToken: deref(data.RefreshToken),
 		Expiry:       deref(data.Expires),
 	}
-	tok = withExtras(tok, userID)
-	t.tok = tok
-	return tok, nil
+	if tok.Expiry.IsZero() {
+		tok.Expiry = guessExpiry(t.log(), tok.AccessToken)
+	}
+	return withExtras(tok, userID), nil
 }
 
 // This seems to be roughly when tokens seem to expire
 const assumeExpire = 8 * time.Hour
 
-// The /authenticate endpoint doesn't return a token expiry, so we have to guess.
-// Fortunately it looks like this appears to be encoded in the token itself.
-func guessExpiry(tok string) time.Time {
-	jwtExpFieldRe := regexp.MustCompile(`"exp":(\d+),`)
-	if strings.HasPrefix(tok, "t1.v2.") {
-		parts := strings.SplitN(tok, ".", 5)
-		if len(parts) == 5 {
-			// This field appears to be a truncated base64-encoded JSON (JWT) object,
-			// so we'll likely get an ErrUnexpectedEOF. Fortunately the bit we're
-			// interested in is in the first part, so we can ignore the error.
-			dr := base64.NewDecoder(base64.StdEncoding, strings.NewReader(parts[3]))
-			data, err := io.ReadAll(dr)
-			if err == nil || err == io.ErrUnexpectedEOF {
-				if m := jwtExpFieldRe.FindStringSubmatch(string(data)); m != nil {
-					secs, err := strconv.ParseInt(m[1], 10, 64)
-					if err == nil {
-						t := time.Unix(secs, 0)
-						until := time.Until(t)
-						if until > 10*time.Minute { // sanity check, we don't actually know if any of this is right
-							debug("senseauth: using expiry from token: ", time.Until(t))
-							return t
-						} else {
-							log.Printf("senseauth: embedded expiry is suspiciously soon, ignoring: %s", until)
-						}
-					}
-				}
-			}
-		}
+// The /authenticate endpoint doesn't return a token expiry, so we take it
+// from the token itself, or guess if the token isn't in a format we know.
+func guessExpiry(log *slog.Logger, tok string) time.Time {
+	if info, err := ParseToken(tok); err == nil && !info.Expiry.IsZero() {
+		log.Debug("senseauth: using expiry from token", slog.Duration("expires_in", time.Until(info.Expiry)))
+		return info.Expiry
 	}
-	debug("senseauth: assuming expiry: ", assumeExpire)
+	log.Debug("senseauth: assuming expiry", slog.Duration("expires_in", assumeExpire))
 	return time.Now().Add(assumeExpire)
 }
@@ -0,0 +1,326 @@
+package senseauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/senseauth"
+	"github.com/dnesting/sense/sensetest"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenSourceForUser(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+	})
+	defer srv.Close()
+	ctx := context.Background()
+	conf := senseauth.Config{BaseURL: srv.ApiUrl()}
+
+	tok, _, err := conf.PasswordCredentialsToken(ctx, senseauth.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := senseauth.UserID(tok)
+
+	// Round-trip the token through JSON, as if it had been stored,
+	// which loses the user ID.
+	data, err := json.Marshal(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored oauth2.Token
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.Expiry = time.Now().Add(-time.Minute)
+
+	if _, err := conf.TokenSource(&stored).TokenContext(ctx); !errors.Is(err, senseauth.ErrTokenMissingUserID) {
+		t.Errorf("expected ErrTokenMissingUserID, got %v", err)
+	}
+
+	renewed, err := conf.TokenSourceForUser(&stored, userID).TokenContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.AccessToken == stored.AccessToken {
+		t.Error("expected a renewed token")
+	}
+	if senseauth.UserID(renewed) != userID {
+		t.Errorf("expected user ID %d on renewed token, got %d", userID, senseauth.UserID(renewed))
+	}
+}
+
+func TestTokenSourceErrors(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := senseauth.DefaultConfig.TokenSource(nil).TokenContext(ctx); !errors.Is(err, senseauth.ErrNoToken) {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+
+	// A Config that can't build its client should report that when it's
+	// used, rather than panicking.
+	bad := senseauth.Config{BaseURL: "http://[::1"}
+	if _, err := bad.TokenSource(senseauth.NewToken("access", "refresh", 1)).TokenContext(ctx); err == nil || !strings.Contains(err.Error(), "create client") {
+		t.Errorf("expected error creating client, got %v", err)
+	}
+	if _, _, err := bad.PasswordCredentialsToken(ctx, senseauth.PasswordCredentials{}); err == nil || !strings.Contains(err.Error(), "create client") {
+		t.Errorf("expected error creating client, got %v", err)
+	}
+}
+
+// countRenewals counts requests to /renew, and remembers the context of
+// the last one.
+type countRenewals struct {
+	n       atomic.Int32
+	lastCtx atomic.Pointer[context.Context]
+}
+
+func (c *countRenewals) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/renew") {
+		c.n.Add(1)
+		ctx := req.Context()
+		c.lastCtx.Store(&ctx)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newRenewTest returns a Config that counts renewals, along with a token
+// for an account on srv.
+func newRenewTest(t *testing.T, srv *sensetest.Server) (senseauth.Config, *countRenewals, *oauth2.Token) {
+	t.Helper()
+	counter := &countRenewals{}
+	conf := senseauth.Config{
+		BaseURL:    srv.ApiUrl(),
+		HttpClient: &http.Client{Transport: counter},
+	}
+	tok, _, err := conf.PasswordCredentialsToken(context.Background(), senseauth.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf, counter, tok
+}
+
+func TestTokenSourceConcurrentRenewal(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{Email: "test@example.com", Password: "pass"})
+	defer srv.Close()
+	conf, counter, tok := newRenewTest(t, srv)
+
+	expired := *tok
+	expired.Expiry = time.Now().Add(-time.Minute)
+	ts := conf.TokenSourceForUser(&expired, senseauth.UserID(tok))
+
+	var wg sync.WaitGroup
+	toks := make([]*oauth2.Token, 10)
+	for i := range toks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := ts.TokenContext(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			toks[i] = tok
+		}()
+	}
+	wg.Wait()
+
+	if n := counter.n.Load(); n != 1 {
+		t.Errorf("expected 1 renewal, got %d", n)
+	}
+	for _, tok := range toks {
+		if tok == nil || tok.AccessToken != toks[0].AccessToken {
+			t.Errorf("expected all callers to get the same token")
+			break
+		}
+	}
+}
+
+// blockRenewals holds requests to /renew until release is closed.
+type blockRenewals struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockRenewals) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/renew") {
+		close(b.started)
+		select {
+		case <-b.release:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTokenSourceRenewalOutlivesCaller(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{Email: "test@example.com", Password: "pass"})
+	defer srv.Close()
+	blocker := &blockRenewals{started: make(chan struct{}), release: make(chan struct{})}
+	conf := senseauth.Config{
+		BaseURL:    srv.ApiUrl(),
+		HttpClient: &http.Client{Transport: blocker},
+	}
+	tok, _, err := conf.PasswordCredentialsToken(context.Background(), senseauth.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := *tok
+	expired.Expiry = time.Now().Add(-time.Minute)
+	ts := conf.TokenSourceForUser(&expired, senseauth.UserID(tok))
+
+	// The first caller starts the renewal, then gives up on it.
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error)
+	go func() {
+		_, err := ts.TokenContext(ctx)
+		leaderErr <- err
+	}()
+	<-blocker.started
+
+	// A second caller waits for the same renewal.
+	type result struct {
+		tok *oauth2.Token
+		err error
+	}
+	waiter := make(chan result)
+	go func() {
+		tok, err := ts.TokenContext(context.Background())
+		waiter <- result{tok, err}
+	}()
+	time.Sleep(10 * time.Millisecond) // let it start waiting
+
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected first caller to get context.Canceled, got %v", err)
+	}
+	close(blocker.release)
+	if r := <-waiter; r.err != nil || r.tok == nil || r.tok.AccessToken == tok.AccessToken {
+		t.Errorf("expected second caller to get a renewed token, got %v, %v", r.tok, r.err)
+	}
+}
+
+func TestTokenSourceRefreshAhead(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{Email: "test@example.com", Password: "pass"})
+	defer srv.Close()
+	conf, counter, tok := newRenewTest(t, srv)
+	ctx := context.Background()
+
+	expiring := *tok
+	expiring.Expiry = time.Now().Add(30 * time.Minute)
+
+	got, err := conf.TokenSourceForUser(&expiring, senseauth.UserID(tok)).TokenContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != tok.AccessToken || counter.n.Load() != 0 {
+		t.Error("expected token to be used without renewal")
+	}
+
+	conf.RefreshAhead = time.Hour
+	got, err = conf.TokenSourceForUser(&expiring, senseauth.UserID(tok)).TokenContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken == tok.AccessToken || counter.n.Load() != 1 {
+		t.Error("expected token to be renewed early")
+	}
+
+	// A failed early renewal should fall back to the existing token.
+	bad := expiring
+	bad.RefreshToken = "bogus"
+	got, err = conf.TokenSourceForUser(&bad, senseauth.UserID(tok)).TokenContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != tok.AccessToken {
+		t.Error("expected existing token after failed early renewal")
+	}
+
+	// It shouldn't try again right away.
+	ts := conf.TokenSourceForUser(&bad, senseauth.UserID(tok))
+	before := counter.n.Load()
+	for range 3 {
+		if _, err := ts.TokenContext(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := counter.n.Load() - before; n != 1 {
+		t.Errorf("expected 1 early renewal attempt after failure, got %d", n)
+	}
+}
+
+func TestTransportRetry(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 123}},
+	})
+	defer srv.Close()
+	conf, counter, tok := newRenewTest(t, srv)
+	hc := conf.Client(tok)
+	url := srv.ApiUrl() + "app/monitors/123/devices/overview"
+
+	get := func(ctx context.Context) (int, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return 0, err
+		}
+		res, err := hc.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	// The token looks valid, but the server has expired it.
+	srv.ExpireTokens()
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	if code, err := get(ctx); err != nil || code != http.StatusOK {
+		t.Errorf("expected 200 after retry, got %d, %v", code, err)
+	}
+	if n := counter.n.Load(); n != 1 {
+		t.Errorf("expected 1 renewal, got %d", n)
+	}
+	// The renewal should have been made in the context of the request.
+	if renewCtx := counter.lastCtx.Load(); renewCtx == nil || (*renewCtx).Value(ctxKey{}) != "request" {
+		t.Error("expected renewal to use the request's context")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{Email: "test@example.com", Password: "pass"})
+	defer srv.Close()
+	conf, _, tok := newRenewTest(t, srv)
+	ctx := context.Background()
+
+	if err := conf.Revoke(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+	expired := *tok
+	expired.Expiry = time.Now().Add(-time.Minute)
+	if _, err := conf.TokenSource(&expired).TokenContext(ctx); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected renewal of revoked token to fail, got %v", err)
+	}
+}
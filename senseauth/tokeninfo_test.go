@@ -0,0 +1,112 @@
+package senseauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dnesting/sense/senseauth"
+	"github.com/dnesting/sense/sensetest"
+	"golang.org/x/oauth2"
+)
+
+func TestParseToken(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	header := enc([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := enc([]byte(`{"iss":"test","exp":1700003600,"iat":1700000000,"user_id":42}`))
+
+	for _, tok := range []string{
+		"t1.v2." + header + "." + claims + ".sig",
+		header + "." + claims + ".sig",
+	} {
+		info, err := senseauth.ParseToken(tok)
+		if err != nil {
+			t.Fatalf("ParseToken(%q): %v", tok, err)
+		}
+		want := senseauth.TokenInfo{
+			Issuer:   "test",
+			Expiry:   time.Unix(1700003600, 0),
+			IssuedAt: time.Unix(1700000000, 0),
+			UserID:   42,
+		}
+		if *info != want {
+			t.Errorf("ParseToken(%q) = %+v, want %+v", tok, *info, want)
+		}
+	}
+
+	for _, tok := range []string{
+		"",
+		"opaque-token",
+		"t1.v2.a.b",
+		header + ".!!!.sig",
+		header + "." + enc([]byte("not json")) + ".sig",
+	} {
+		if _, err := senseauth.ParseToken(tok); !errors.Is(err, senseauth.ErrUnknownTokenFormat) {
+			t.Errorf("ParseToken(%q): expected ErrUnknownTokenFormat, got %v", tok, err)
+		}
+	}
+}
+
+func TestParseTokenTruncated(t *testing.T) {
+	// Real Sense tokens look like this: a standard-encoded payload that is
+	// cut off partway through, followed by further dot-separated fields.
+	header := base64.StdEncoding.EncodeToString([]byte(`{"alg":"HS512","typ":"JWT"}`))
+	payload := base64.StdEncoding.EncodeToString([]byte(`{"iss":"sense","exp":1700003600,"iat":1700000000,"user_id":42,"roles":["user"],"scope":"all"}`))
+	for _, n := range []int{99, 100, 101} {
+		tok := "t1.v2." + header + "." + payload[:n] + ".AbC-dEf.Gh_Ij"
+		info, err := senseauth.ParseToken(tok)
+		if err != nil {
+			t.Fatalf("ParseToken(%q): %v", tok, err)
+		}
+		want := senseauth.TokenInfo{
+			Issuer:   "sense",
+			Expiry:   time.Unix(1700003600, 0),
+			IssuedAt: time.Unix(1700000000, 0),
+			UserID:   42,
+		}
+		if *info != want {
+			t.Errorf("ParseToken(%q) = %+v, want %+v", tok, *info, want)
+		}
+	}
+
+	// A payload cut off before the expiry is complete tells us nothing.
+	tok := "t1.v2." + header + "." + payload[:30] + ".sig"
+	if _, err := senseauth.ParseToken(tok); !errors.Is(err, senseauth.ErrUnknownTokenFormat) {
+		t.Errorf("ParseToken(%q): expected ErrUnknownTokenFormat, got %v", tok, err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:         "test@example.com",
+		Password:      "pass",
+		TokenLifetime: 20 * time.Minute,
+	})
+	defer srv.Close()
+	conf := senseauth.Config{BaseURL: srv.ApiUrl()}
+
+	tok, _, err := conf.PasswordCredentialsToken(context.Background(), senseauth.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(tok.Expiry); d < 19*time.Minute || d > 20*time.Minute {
+		t.Errorf("expected token to expire in 20m, got %s", d)
+	}
+
+	info, err := conf.TokenSource(tok).Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Issuer != "sensetest" || info.UserID != senseauth.UserID(tok) || !info.Expiry.Equal(tok.Expiry) {
+		t.Errorf("unexpected token info: %+v", info)
+	}
+
+	if _, err := conf.TokenSource(&oauth2.Token{AccessToken: "opaque"}).Info(); !errors.Is(err, senseauth.ErrUnknownTokenFormat) {
+		t.Errorf("expected ErrUnknownTokenFormat, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package senseauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// TOTP generates RFC 6238 time-based one-time passwords from a shared secret,
+// such as the one shown (or encoded in the QR code) when MFA is enabled on a
+// Sense account.  This allows MFA logins to happen unattended.
+type TOTP struct {
+	// Secret is the base32-encoded shared secret.  Case, spaces, and
+	// padding are ignored.
+	Secret string
+
+	// Digits is the number of digits in each code.  If zero, 6 is used.
+	Digits int
+
+	// Period is how long each code is valid for, in whole seconds.
+	// If zero, 30 seconds is used.
+	Period time.Duration
+
+	// Skew is the allowed clock skew between us and the server.  If the
+	// current code will expire within Skew, MfaFunc waits for the next
+	// one instead, so that it is not rejected as stale.  It must be less
+	// than Period.
+	Skew time.Duration
+
+	// Logger receives log records from the MfaFunc.  If nil, the logger
+	// set with SetDebug is used, if any.
+	Logger *slog.Logger
+}
+
+const (
+	defaultTOTPDigits = 6
+	defaultTOTPPeriod = 30 * time.Second
+)
+
+func (t TOTP) digits() int {
+	if t.Digits == 0 {
+		return defaultTOTPDigits
+	}
+	return t.Digits
+}
+
+func (t TOTP) period() time.Duration {
+	if t.Period == 0 {
+		return defaultTOTPPeriod
+	}
+	return t.Period
+}
+
+// key decodes the secret and validates the rest of the configuration.
+func (t TOTP) key() ([]byte, error) {
+	if d := t.digits(); d < 1 || d > 10 {
+		return nil, fmt.Errorf("senseauth: totp: invalid number of digits: %d", d)
+	}
+	if p := t.period(); p < time.Second || p%time.Second != 0 {
+		return nil, fmt.Errorf("senseauth: totp: period must be whole seconds: %s", p)
+	}
+	if t.Skew < 0 || t.Skew >= t.period() {
+		return nil, fmt.Errorf("senseauth: totp: skew must be less than period: %s", t.Skew)
+	}
+	secret := strings.ToUpper(strings.Join(strings.Fields(t.Secret), ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, errors.New("senseauth: totp: no secret")
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("senseauth: totp: decode secret: %w", err)
+	}
+	return key, nil
+}
+
+// Code returns the code that is valid at the given time.
+func (t TOTP) Code(at time.Time) (string, error) {
+	key, err := t.key()
+	if err != nil {
+		return "", err
+	}
+	return t.code(key, at), nil
+}
+
+func (t TOTP) code(key []byte, at time.Time) string {
+	counter := at.Unix() / int64(t.period()/time.Second)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, per RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0xf
+	value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	mod := uint64(1)
+	for i := 0; i < t.digits(); i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.digits(), value%mod)
+}
+
+// MfaFunc returns an MfaFunc that generates codes from t, suitable for use
+// as the MfaFn in [PasswordCredentials].  It returns an error if the secret
+// or other settings are invalid.
+func (t TOTP) MfaFunc() (MfaFunc, error) {
+	key, err := t.key()
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (string, error) {
+		now := time.Now()
+		period := t.period()
+		remaining := period - time.Duration(now.UnixNano()%int64(period))
+		if remaining <= t.Skew {
+			logger(t.Logger).Debug("senseauth: totp code expires soon, waiting for the next one",
+				slog.Duration("remaining", remaining))
+			timer := time.NewTimer(remaining)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-timer.C:
+			}
+			now = now.Add(remaining)
+		}
+		return t.code(key, now), nil
+	}, nil
+}
@@ -0,0 +1,75 @@
+package senseauth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dnesting/sense/senseauth"
+)
+
+// rfc6238Secret is the base32 encoding of the SHA1 secret used for the
+// test vectors in RFC 6238 appendix B ("12345678901234567890").
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	totp := senseauth.TOTP{Secret: rfc6238Secret, Digits: 8}
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		got, err := totp.Code(time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	// Default digits, and a secret formatted the way it is often displayed.
+	totp = senseauth.TOTP{Secret: "gezd gnbv gy3t qojq gezd gnbv gy3t qojq"}
+	if got, err := totp.Code(time.Unix(59, 0)); err != nil || got != "287082" {
+		t.Errorf("Code(59) = %s, %v, want 287082", got, err)
+	}
+}
+
+func TestTOTPInvalid(t *testing.T) {
+	for _, totp := range []senseauth.TOTP{
+		{},
+		{Secret: "not base32!"},
+		{Secret: rfc6238Secret, Digits: 11},
+		{Secret: rfc6238Secret, Period: 1500 * time.Millisecond},
+		{Secret: rfc6238Secret, Skew: time.Minute},
+	} {
+		if _, err := totp.MfaFunc(); err == nil {
+			t.Errorf("expected error for %+v", totp)
+		}
+	}
+}
+
+func TestTOTPMfaFunc(t *testing.T) {
+	totp := senseauth.TOTP{Secret: rfc6238Secret, Skew: time.Second}
+	fn, err := totp.MfaFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	code, err := fn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The code must be current, or the next one if we had to wait.
+	now, _ := totp.Code(before)
+	next, _ := totp.Code(before.Add(totp.Skew))
+	if code != now && code != next {
+		t.Errorf("unexpected code %s, expected %s or %s", code, now, next)
+	}
+}
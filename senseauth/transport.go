@@ -0,0 +1,97 @@
+package senseauth
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Transport is an http.RoundTripper that authenticates requests using tokens
+// from Source.  Unlike oauth2.Transport, renewals use the context of the
+// request that needed them, so deadlines and traces carry through to the
+// renewal.
+//
+// If the server responds with 401 Unauthorized, the token is renewed and the
+// request is retried once.  Requests with a body are retried only if
+// req.GetBody is set, as it is for requests created with http.NewRequest.
+type Transport struct {
+	Source *TokenSource
+
+	// Base is the RoundTripper used to make requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip authorizes and sends the request, renewing the token if needed.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tok, err := t.Source.TokenContext(ctx)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	res, err := t.base().RoundTrip(withToken(req, tok))
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		t.Source.log().Debug("senseauth: got 401 but request body can't be replayed",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path))
+		return res, nil
+	}
+
+	// The token may have been revoked or expired early, so try a new one.
+	t.Source.log().Debug("senseauth: got 401, renewing token and retrying",
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path))
+	t.Source.invalidate(tok)
+	retryTok, err := t.Source.TokenContext(ctx)
+	if err != nil || retryTok.AccessToken == tok.AccessToken {
+		return res, nil
+	}
+	retry := withToken(req, retryTok)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+		retry.Body = body
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return t.base().RoundTrip(retry)
+}
+
+// withToken returns a copy of req carrying tok in its Authorization header.
+func withToken(req *http.Request, tok *oauth2.Token) *http.Request {
+	req = req.Clone(req.Context())
+	tok.SetAuthHeader(req)
+	return req
+}
+
+// invalidate marks tok as expired, if it is still the current token, so that
+// the next call to TokenContext will renew it.
+func (t *TokenSource) invalidate(tok *oauth2.Token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tok != nil && t.tok.AccessToken == tok.AccessToken {
+		expired := *t.tok
+		expired.Expiry = time.Now()
+		t.tok = &expired
+	}
+}
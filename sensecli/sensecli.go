@@ -23,6 +23,9 @@
 //	    password-from:	# read the password from a file
 //	    mfa-from:		# read the MFA code from a file
 //	    mfa-command:	# read the MFA code from a command
+//	    mfa-secret:		# generate MFA codes from this TOTP secret (base32)
+//	    mfa-secret-from:	# read the TOTP secret from a file
+//	    mfa-skew:		# with mfa-secret, wait for a new code if the current one expires within this long (default 5s)
 //
 // Multiple accounts can be configured in the same file.  If you specify a configuration file, flags
 // and environment variables will be ignored.
@@ -35,6 +38,9 @@
 //	--sense-password-from
 //	--sense-mfa-from
 //	--sense-mfa-command
+//	--sense-mfa-secret
+//	--sense-mfa-secret-from
+//	--sense-mfa-skew
 //
 // These environment variables will be used for any flag that is not set:
 //
@@ -44,22 +50,33 @@
 //	SENSE_PASSWORD_FROM
 //	SENSE_MFA_FROM
 //	SENSE_MFA_COMMAND
+//	SENSE_MFA_SECRET
+//	SENSE_MFA_SECRET_FROM
+//	SENSE_MFA_SKEW
 //
 // These will be blended into one set of credentials that will be used to authenticate the client.
 //
+// The MFA secret is the shared secret shown (usually as a QR code) when MFA is enabled on the
+// account.  With it, MFA codes are generated automatically, so logins can be fully unattended.
+// Only one way of obtaining MFA codes (mfa-from, mfa-command, or mfa-secret/mfa-secret-from)
+// may be configured.
+//
 // If no flags or environment variables are set, a single unauthenticated Sense client will be created.
 package sensecli
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/senseauth"
 	"gopkg.in/yaml.v3"
 )
 
@@ -71,6 +88,10 @@ type PasswordCredentials struct {
 	PasswordFrom string `json:"password-from,omitempty" yaml:"password-from,omitempty"`
 	MfaFrom      string `json:"mfa-from,omitempty" yaml:"mfa-from,omitempty"`
 	MfaCommand   string `json:"mfa-command,omitempty" yaml:"mfa-command,omitempty"`
+
+	MfaSecret     string `json:"mfa-secret,omitempty" yaml:"mfa-secret,omitempty"`
+	MfaSecretFrom string `json:"mfa-secret-from,omitempty" yaml:"mfa-secret-from,omitempty"`
+	MfaSkew       string `json:"mfa-skew,omitempty" yaml:"mfa-skew,omitempty"`
 }
 
 // Account in the ConfigFile contains credentials for a single Sense account.
@@ -92,6 +113,10 @@ type varNames struct {
 	PasswordFrom string
 	MfaFrom      string
 	MfaCommand   string
+
+	MfaSecret     string
+	MfaSecretFrom string
+	MfaSkew       string
 }
 
 var StandardEnvVars = varNames{
@@ -102,6 +127,10 @@ var StandardEnvVars = varNames{
 	PasswordFrom: "SENSE_PASSWORD_FROM",
 	MfaFrom:      "SENSE_MFA_FROM",
 	MfaCommand:   "SENSE_MFA_COMMAND",
+
+	MfaSecret:     "SENSE_MFA_SECRET",
+	MfaSecretFrom: "SENSE_MFA_SECRET_FROM",
+	MfaSkew:       "SENSE_MFA_SKEW",
 }
 
 var StandardFlagVars = varNames{
@@ -112,6 +141,10 @@ var StandardFlagVars = varNames{
 	PasswordFrom: "sense-password-from",
 	MfaFrom:      "sense-mfa-from",
 	MfaCommand:   "sense-mfa-command",
+
+	MfaSecret:     "sense-mfa-secret",
+	MfaSecretFrom: "sense-mfa-secret-from",
+	MfaSkew:       "sense-mfa-skew",
 }
 
 func CredentialsFromStandardEnv() *PasswordCredentials {
@@ -126,6 +159,10 @@ func CredentialsFromEnv(vars varNames) *PasswordCredentials {
 		PasswordFrom: os.Getenv(vars.PasswordFrom),
 		MfaFrom:      os.Getenv(vars.MfaFrom),
 		MfaCommand:   os.Getenv(vars.MfaCommand),
+
+		MfaSecret:     os.Getenv(vars.MfaSecret),
+		MfaSecretFrom: os.Getenv(vars.MfaSecretFrom),
+		MfaSkew:       os.Getenv(vars.MfaSkew),
 	}
 }
 
@@ -148,6 +185,15 @@ func BlendCredentials(a, b PasswordCredentials) *PasswordCredentials {
 	if a.MfaCommand == "" {
 		a.MfaCommand = b.MfaCommand
 	}
+	if a.MfaSecret == "" {
+		a.MfaSecret = b.MfaSecret
+	}
+	if a.MfaSecretFrom == "" {
+		a.MfaSecretFrom = b.MfaSecretFrom
+	}
+	if a.MfaSkew == "" {
+		a.MfaSkew = b.MfaSkew
+	}
 	return &a
 }
 
@@ -163,6 +209,9 @@ func SetupCredentialsFromFlags(flagPrefix string, names varNames, flagSuffix, de
 	flag.StringVar(&creds.PasswordFrom, flagPrefix+names.PasswordFrom+flagSuffix, "", "Read Sense password from this file"+descSuffix)
 	flag.StringVar(&creds.MfaFrom, flagPrefix+names.MfaFrom+flagSuffix, "", "Sense MFA code"+descSuffix)
 	flag.StringVar(&creds.MfaCommand, flagPrefix+names.MfaCommand+flagSuffix, "", "Read Sense MFA code from the output of this command"+descSuffix)
+	flag.StringVar(&creds.MfaSecret, flagPrefix+names.MfaSecret+flagSuffix, "", "Generate Sense MFA codes from this TOTP secret"+descSuffix)
+	flag.StringVar(&creds.MfaSecretFrom, flagPrefix+names.MfaSecretFrom+flagSuffix, "", "Read Sense MFA TOTP secret from this file"+descSuffix)
+	flag.StringVar(&creds.MfaSkew, flagPrefix+names.MfaSkew+flagSuffix, "", "Wait for a new TOTP code if the current one expires within this long (default 5s)"+descSuffix)
 	return creds
 }
 
@@ -221,6 +270,10 @@ func readFile(filename string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
+// defaultMfaSkew is how close to expiring a TOTP code can be before we wait
+// for the next one.
+const defaultMfaSkew = 5 * time.Second
+
 func generateSenseCreds(creds *PasswordCredentials) (*sense.PasswordCredentials, error) {
 	if creds == nil {
 		return nil, nil // empty credentials = unauthenticated
@@ -247,6 +300,20 @@ func generateSenseCreds(creds *PasswordCredentials) (*sense.PasswordCredentials,
 		}
 	}
 
+	mfaSources := 0
+	for _, set := range []bool{
+		creds.MfaFrom != "",
+		creds.MfaCommand != "",
+		creds.MfaSecret != "" || creds.MfaSecretFrom != "",
+	} {
+		if set {
+			mfaSources++
+		}
+	}
+	if mfaSources > 1 {
+		return nil, errors.New("only one of mfa-from, mfa-command, or mfa-secret/mfa-secret-from may be set")
+	}
+
 	if creds.MfaFrom != "" {
 		code, err := readFile(creds.MfaFrom)
 		if err != nil {
@@ -264,6 +331,25 @@ func generateSenseCreds(creds *PasswordCredentials) (*sense.PasswordCredentials,
 			}
 			return strings.TrimSpace(string(out)), nil
 		}
+	} else if creds.MfaSecret != "" || creds.MfaSecretFrom != "" {
+		secret := creds.MfaSecret
+		if secret == "" {
+			secret, err = readFile(creds.MfaSecretFrom)
+			if err != nil {
+				return nil, err
+			}
+		}
+		skew := defaultMfaSkew
+		if creds.MfaSkew != "" {
+			skew, err = time.ParseDuration(creds.MfaSkew)
+			if err != nil {
+				return nil, fmt.Errorf("mfa-skew: %w", err)
+			}
+		}
+		userpass.MfaFn, err = senseauth.TOTP{Secret: secret, Skew: skew}.MfaFunc()
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &userpass, nil
 }
@@ -0,0 +1,112 @@
+package sensecli_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnesting/sense/sensecli"
+	"github.com/dnesting/sense/sensetest"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+// writeConfig writes a YAML config file and returns its path.
+func writeConfig(t *testing.T, yaml string) *string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &path
+}
+
+func TestCreateClientsTOTP(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:     "test@example.com",
+		Password:  "pass",
+		MfaSecret: testSecret,
+		Monitors:  []*sensetest.Monitor{{ID: 123}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+
+	config := writeConfig(t, `
+accounts:
+- credentials:
+    email: test@example.com
+    password: pass
+    mfa-secret: `+testSecret+`
+    mfa-skew: 0s
+`)
+	clients, err := sensecli.CreateClients(ctx, config, &sensecli.PasswordCredentials{}, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("expected 1 client, got %d", len(clients))
+	}
+	client := clients[0]
+	if client.GetUserID() == 0 || len(client.GetMonitors()) != 1 {
+		t.Errorf("expected an authenticated client with 1 monitor")
+	}
+
+	// The token should be renewable without another MFA code.
+	srv.ExpireTokens()
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Errorf("expected renewal after TOTP login, got %v", err)
+	}
+}
+
+func TestCreateClientsMfaErrors(t *testing.T) {
+	t.Setenv("SENSE_CONFIG", "")
+	srv := sensetest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	codeFile := filepath.Join(t.TempDir(), "code")
+	if err := os.WriteFile(codeFile, []byte("123456\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		creds sensecli.PasswordCredentials
+		want  string
+	}{
+		{"mfa-from and mfa-secret", sensecli.PasswordCredentials{MfaFrom: codeFile, MfaSecret: testSecret}, "only one of"},
+		{"mfa-command and mfa-secret-from", sensecli.PasswordCredentials{MfaCommand: "true", MfaSecretFrom: codeFile}, "only one of"},
+		{"mfa-from and mfa-command", sensecli.PasswordCredentials{MfaFrom: codeFile, MfaCommand: "true"}, "only one of"},
+		{"bad skew", sensecli.PasswordCredentials{MfaSecret: testSecret, MfaSkew: "soon"}, "mfa-skew"},
+		{"bad secret", sensecli.PasswordCredentials{MfaSecret: "not base32!"}, "totp"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := tt.creds
+			creds.Email = "test@example.com"
+			creds.Password = "pass"
+			noConfig := ""
+			_, err := sensecli.CreateClients(ctx, &noConfig, &creds, srv.Options()...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv("SENSE_MFA_SECRET", testSecret)
+	t.Setenv("SENSE_MFA_SECRET_FROM", "/secret")
+	t.Setenv("SENSE_MFA_SKEW", "2s")
+
+	env := sensecli.CredentialsFromStandardEnv()
+	if env.MfaSecret != testSecret || env.MfaSecretFrom != "/secret" || env.MfaSkew != "2s" {
+		t.Errorf("unexpected credentials from env: %+v", env)
+	}
+
+	// Flags take precedence over the environment.
+	blended := sensecli.BlendCredentials(sensecli.PasswordCredentials{MfaSkew: "1s"}, *env)
+	if blended.MfaSecret != testSecret || blended.MfaSecretFrom != "/secret" || blended.MfaSkew != "1s" {
+		t.Errorf("unexpected blended credentials: %+v", blended)
+	}
+}
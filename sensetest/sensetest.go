@@ -0,0 +1,687 @@
+// Package sensetest implements a fake Sense API server for testing code
+// that uses the sense package.
+//
+// The server is an [httptest.Server] that implements enough of the REST and
+// real-time APIs for [sense.Connect] to authenticate (including MFA and
+// token renewals), list devices, and stream real-time data:
+//
+//	srv := sensetest.NewServer(&sensetest.Account{
+//		Email:    "you@example.com",
+//		Password: "secret",
+//		Monitors: []*sensetest.Monitor{{
+//			ID: 123,
+//			Realtime: []realtime.Message{
+//				&realtime.Hello{Online: true},
+//				&realtime.RealtimeUpdate{W: 590.4},
+//			},
+//		}},
+//	})
+//	defer srv.Close()
+//
+//	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+//		Email:    "you@example.com",
+//		Password: "secret",
+//	}, srv.Options()...)
+//
+// Accounts and monitors may be modified after the server has started, as
+// long as the server's lock is held (see [Server.Lock]).
+package sensetest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/realtime"
+	"github.com/dnesting/sense/senseauth"
+)
+
+// DefaultTokenLifetime is how long access tokens are valid for if
+// Account.TokenLifetime is zero.
+const DefaultTokenLifetime = time.Hour
+
+// Account is a Sense account known to the fake server.
+type Account struct {
+	Email    string
+	Password string
+	// MfaCode, if set, causes authentication to require an MFA code,
+	// which must match this value.
+	MfaCode string
+	// MfaSecret, if set, causes authentication to require an MFA code
+	// generated from this base32 TOTP secret, as by [senseauth.TOTP].
+	// Codes from the current and previous periods are accepted.
+	MfaSecret string
+
+	// UserID and AccountID are assigned automatically if zero.
+	UserID    int
+	AccountID int
+
+	Monitors []*Monitor
+
+	// TokenLifetime is how long access tokens are valid for.
+	// If zero, DefaultTokenLifetime is used.
+	TokenLifetime time.Duration
+
+	// DateCreated is reported as the date the account was created.
+	DateCreated time.Time
+
+	// notifications holds the notification settings for each monitor,
+	// as last set by the client.
+	notifications   map[string]json.RawMessage
+	settingsVersion int
+}
+
+// Monitor is a Sense monitor belonging to an Account.
+type Monitor struct {
+	ID           int
+	SerialNumber string
+	Devices      []sense.Device
+
+	// These are reported with the account's monitors.  TimeZone is the
+	// name of a time zone, such as "America/New_York".
+	TimeZone          string
+	Online            bool
+	SolarConnected    bool
+	SolarConfigured   bool
+	HardwareType      string
+	EthernetSupported bool
+	ZigbeeSupported   bool
+	Attributes        sense.MonitorAttributes
+
+	// Realtime is the sequence of messages sent to each real-time
+	// connection to this monitor, with RealtimeInterval between them.
+	Realtime         []realtime.Message
+	RealtimeInterval time.Duration
+	// CloseRealtime causes the server to close the real-time connection
+	// once all messages have been sent.  Otherwise it is held open until
+	// the client disconnects.
+	CloseRealtime bool
+}
+
+// token is an access or refresh token.  Tokens issued from the same login
+// share a session, which ends when the user logs out.
+type token struct {
+	account *Account
+	session string
+	expiry  time.Time // zero for refresh tokens
+}
+
+// Server is a fake Sense API server.  Create one with [NewServer].
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	accounts  []*Account
+	access    map[string]*token
+	refresh   map[string]*token
+	mfaTokens map[string]*Account
+	nextID    int
+}
+
+// NewServer starts and returns a new Server with the given accounts.
+// The caller should call Close when finished, to shut it down.
+func NewServer(accounts ...*Account) *Server {
+	s := &Server{
+		accounts:  accounts,
+		access:    make(map[string]*token),
+		refresh:   make(map[string]*token),
+		mfaTokens: make(map[string]*Account),
+		nextID:    1000,
+	}
+	for _, a := range accounts {
+		s.initAccount(a)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /authenticate", s.handleAuthenticate)
+	mux.HandleFunc("POST /renew", s.handleRenew)
+	mux.HandleFunc("POST /logout", s.handleLogout)
+	mux.HandleFunc("GET /users/{user_id}", s.handleUser)
+	mux.HandleFunc("PUT /users/{user_id}/notifications", s.handleNotifications)
+	mux.HandleFunc("GET /app/monitors/{monitor_id}/devices/overview", s.handleDevices)
+	mux.HandleFunc("GET /monitors/{monitor_id}/realtimefeed", s.handleRealtime)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) initAccount(a *Account) {
+	if a.UserID == 0 {
+		s.nextID++
+		a.UserID = s.nextID
+	}
+	if a.AccountID == 0 {
+		s.nextID++
+		a.AccountID = s.nextID
+	}
+}
+
+// Lock locks the server, so that accounts and monitors can be modified
+// safely while it is running.
+func (s *Server) Lock() { s.mu.Lock() }
+
+// Unlock unlocks the server.
+func (s *Server) Unlock() { s.mu.Unlock() }
+
+// AddAccount adds an account to the running server.
+func (s *Server) AddAccount(a *Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initAccount(a)
+	s.accounts = append(s.accounts, a)
+}
+
+// ApiUrl returns the base URL of the fake REST API.
+func (s *Server) ApiUrl() string {
+	return s.URL + "/"
+}
+
+// RealtimeApiUrl returns the base URL of the fake real-time API.
+func (s *Server) RealtimeApiUrl() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/"
+}
+
+// Options returns the options needed for a sense.Client to use this server.
+func (s *Server) Options() []sense.Option {
+	return []sense.Option{
+		sense.WithApiUrl(s.ApiUrl(), s.RealtimeApiUrl()),
+	}
+}
+
+// ExpireTokens immediately expires all access tokens issued so far.
+// Refresh tokens remain valid.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.access {
+		t.expiry = time.Time{}
+	}
+}
+
+func randomString() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// newAccessToken returns a token that resembles those issued by Sense, which
+// embed a JWT after a "t1.v2." prefix.  Callers must hold s.mu.
+func (s *Server) newAccessToken(a *Account, session string) (string, time.Time) {
+	lifetime := a.TokenLifetime
+	if lifetime == 0 {
+		lifetime = DefaultTokenLifetime
+	}
+	now := time.Now()
+	expiry := now.Add(lifetime)
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	claims, _ := json.Marshal(struct {
+		Iss    string `json:"iss"`
+		Exp    int64  `json:"exp"`
+		Iat    int64  `json:"iat"`
+		UserID int    `json:"user_id"`
+		Jti    string `json:"jti"`
+	}{"sensetest", expiry.Unix(), now.Unix(), a.UserID, randomString()})
+	tok := "t1.v2." + enc.EncodeToString(header) + "." + enc.EncodeToString(claims) + "." + randomString()
+	s.access[tok] = &token{account: a, session: session, expiry: expiry}
+	return tok, expiry
+}
+
+// newRefreshToken returns a new refresh token.  Callers must hold s.mu.
+func (s *Server) newRefreshToken(a *Account, session string) string {
+	tok := "r1." + randomString()
+	s.refresh[tok] = &token{account: a, session: session}
+	return tok
+}
+
+type apiError struct {
+	Status      string `json:"status"`
+	ErrorReason string `json:"error_reason"`
+	MfaToken    string `json:"mfa_token,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, reason string) {
+	writeJSON(w, code, apiError{Status: "error", ErrorReason: reason})
+}
+
+type monitorJSON struct {
+	ID                int                   `json:"id"`
+	SerialNumber      string                `json:"serial_number,omitempty"`
+	TimeZone          string                `json:"time_zone,omitempty"`
+	Online            bool                  `json:"online"`
+	SolarConnected    bool                  `json:"solar_connected"`
+	SolarConfigured   bool                  `json:"solar_configured"`
+	HardwareType      string                `json:"hardware_type,omitempty"`
+	EthernetSupported bool                  `json:"ethernet_supported"`
+	ZigbeeSupported   bool                  `json:"zigbee_supported"`
+	Attributes        monitorAttributesJSON `json:"attributes"`
+}
+
+type monitorAttributesJSON struct {
+	Cost                float64 `json:"cost"`
+	UserSetCost         bool    `json:"user_set_cost"`
+	SellBackRate        float64 `json:"sell_back_rate"`
+	UserSetSellBackRate bool    `json:"user_set_sell_back_rate"`
+	ShowCost            bool    `json:"show_cost"`
+	TOUEnabled          bool    `json:"tou_enabled"`
+	SolarTOUEnabled     bool    `json:"solar_tou_enabled"`
+	PostalCode          string  `json:"postal_code,omitempty"`
+	PowerRegion         string  `json:"power_region,omitempty"`
+	HomeType            string  `json:"home_type,omitempty"`
+	HomeSizeType        string  `json:"home_size_type,omitempty"`
+	BasementType        string  `json:"basement_type,omitempty"`
+	OccupancyType       string  `json:"occupancy_type,omitempty"`
+	NumberOfOccupants   string  `json:"number_of_occupants,omitempty"`
+	YearBuiltType       string  `json:"year_built_type,omitempty"`
+}
+
+type helloJSON struct {
+	Authorized   bool              `json:"authorized"`
+	AccountID    int               `json:"account_id"`
+	UserID       int               `json:"user_id"`
+	AccessToken  string            `json:"access_token,omitempty"`
+	RefreshToken string            `json:"refresh_token,omitempty"`
+	Monitors     []monitorJSON     `json:"monitors"`
+	Settings     *userSettingsJSON `json:"settings,omitempty"`
+	TOTPEnabled  bool              `json:"totp_enabled"`
+	DateCreated  *time.Time        `json:"date_created,omitempty"`
+}
+
+type userSettingsJSON struct {
+	Version  int `json:"version"`
+	UserID   int `json:"user_id"`
+	Settings struct {
+		Notifications map[string]json.RawMessage `json:"notifications"`
+		LabsEnabled   bool                       `json:"labs_enabled"`
+	} `json:"settings"`
+}
+
+// userSettings returns the settings for an account.  Callers must hold s.mu.
+func userSettings(a *Account) *userSettingsJSON {
+	us := &userSettingsJSON{Version: a.settingsVersion, UserID: a.UserID}
+	us.Settings.Notifications = a.notifications
+	if us.Settings.Notifications == nil {
+		us.Settings.Notifications = make(map[string]json.RawMessage)
+	}
+	return us
+}
+
+// helloFor returns the account details for a, as returned by /authenticate
+// (without tokens).  Callers must hold s.mu.
+func helloFor(a *Account) helloJSON {
+	h := helloJSON{
+		Authorized:  true,
+		AccountID:   a.AccountID,
+		UserID:      a.UserID,
+		Monitors:    monitorsJSON(a),
+		Settings:    userSettings(a),
+		TOTPEnabled: a.needsMfa(),
+	}
+	if !a.DateCreated.IsZero() {
+		h.DateCreated = &a.DateCreated
+	}
+	return h
+}
+
+// monitorsJSON returns the monitors for an account.  Callers must hold s.mu.
+func monitorsJSON(a *Account) []monitorJSON {
+	ms := make([]monitorJSON, 0, len(a.Monitors))
+	for _, m := range a.Monitors {
+		attr := m.Attributes
+		ms = append(ms, monitorJSON{
+			ID:                m.ID,
+			SerialNumber:      m.SerialNumber,
+			TimeZone:          m.TimeZone,
+			Online:            m.Online,
+			SolarConnected:    m.SolarConnected,
+			SolarConfigured:   m.SolarConfigured,
+			HardwareType:      m.HardwareType,
+			EthernetSupported: m.EthernetSupported,
+			ZigbeeSupported:   m.ZigbeeSupported,
+			Attributes: monitorAttributesJSON{
+				Cost:                float64(attr.Cost),
+				UserSetCost:         attr.UserSetCost,
+				SellBackRate:        float64(attr.SellBackRate),
+				UserSetSellBackRate: attr.UserSetSellBackRate,
+				ShowCost:            attr.ShowCost,
+				TOUEnabled:          attr.TOUEnabled,
+				SolarTOUEnabled:     attr.SolarTOUEnabled,
+				PostalCode:          attr.PostalCode,
+				PowerRegion:         attr.PowerRegion,
+				HomeType:            attr.HomeType,
+				HomeSizeType:        attr.HomeSizeType,
+				BasementType:        attr.BasementType,
+				OccupancyType:       attr.OccupancyType,
+				NumberOfOccupants:   attr.NumberOfOccupants,
+				YearBuiltType:       attr.YearBuiltType,
+			},
+		})
+	}
+	return ms
+}
+
+func (a *Account) needsMfa() bool {
+	return a.MfaCode != "" || a.MfaSecret != ""
+}
+
+// validMfaCode reports whether code is an acceptable MFA code for a.
+func (a *Account) validMfaCode(code string) bool {
+	if a.MfaSecret == "" {
+		return code == a.MfaCode
+	}
+	totp := senseauth.TOTP{Secret: a.MfaSecret}
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(-30 * time.Second)} {
+		if want, err := totp.Code(at); err == nil && code == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var acct *Account
+	if mfaToken := r.PostForm.Get("mfa_token"); mfaToken != "" {
+		acct = s.mfaTokens[mfaToken]
+		if acct == nil || !acct.validMfaCode(r.PostForm.Get("totp")) {
+			writeError(w, http.StatusUnauthorized, "Invalid MFA code")
+			return
+		}
+		delete(s.mfaTokens, mfaToken)
+	} else {
+		for _, a := range s.accounts {
+			if a.Email == r.PostForm.Get("email") && a.Password == r.PostForm.Get("password") {
+				acct = a
+				break
+			}
+		}
+		if acct == nil {
+			writeError(w, http.StatusUnauthorized, "Incorrect email or password")
+			return
+		}
+		if acct.needsMfa() {
+			mfaToken := randomString()
+			s.mfaTokens[mfaToken] = acct
+			writeJSON(w, http.StatusUnauthorized, apiError{
+				Status:      "error",
+				ErrorReason: "MFA required",
+				MfaToken:    mfaToken,
+			})
+			return
+		}
+	}
+
+	session := randomString()
+	hello := helloFor(acct)
+	hello.AccessToken, _ = s.newAccessToken(acct, session)
+	hello.RefreshToken = s.newRefreshToken(acct, session)
+	writeJSON(w, http.StatusOK, hello)
+}
+
+func (s *Server) handleRenew(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt := s.refresh[r.PostForm.Get("refresh_token")]
+	if rt == nil || strconv.Itoa(rt.account.UserID) != r.PostForm.Get("user_id") {
+		writeError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	access, expiry := s.newAccessToken(rt.account, rt.session)
+	writeJSON(w, http.StatusOK, struct {
+		AccessToken  string    `json:"access_token"`
+		RefreshToken string    `json:"refresh_token"`
+		Expires      time.Time `json:"expires"`
+	}{access, s.newRefreshToken(rt.account, rt.session), expiry})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.access[bearer(r)]
+	if t == nil || time.Now().After(t.expiry) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	// End the session, revoking all of its tokens.
+	for k, v := range s.access {
+		if v.session == t.session {
+			delete(s.access, k)
+		}
+	}
+	for k, v := range s.refresh {
+		if v.session == t.session {
+			delete(s.refresh, k)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorize returns the account associated with the access token, or nil.
+// Callers must hold s.mu.
+func (s *Server) authorize(tok string) *Account {
+	t := s.access[tok]
+	if t == nil || time.Now().After(t.expiry) {
+		return nil
+	}
+	return t.account
+}
+
+// bearer returns the access token from r's Authorization header.
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// authorizeUser returns the account associated with r's access token, if
+// it matches the user in r's path.  Otherwise it writes an error and
+// returns nil.  Callers must hold s.mu.
+func (s *Server) authorizeUser(w http.ResponseWriter, r *http.Request) *Account {
+	acct := s.authorize(bearer(r))
+	if acct == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil
+	}
+	if r.PathValue("user_id") != strconv.Itoa(acct.UserID) {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return nil
+	}
+	return acct
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.authorizeUser(w, r)
+	if acct == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, helloFor(acct))
+}
+
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.authorizeUser(w, r)
+	if acct == nil {
+		return
+	}
+	monitorID := r.URL.Query().Get("monitor_id")
+	found := false
+	for _, m := range acct.Monitors {
+		if strconv.Itoa(m.ID) == monitorID {
+			found = true
+		}
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "Monitor not found")
+		return
+	}
+	var settings json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if acct.notifications == nil {
+		acct.notifications = make(map[string]json.RawMessage)
+	}
+	acct.notifications[monitorID] = settings
+	acct.settingsVersion++
+	writeJSON(w, http.StatusOK, userSettings(acct))
+}
+
+// findMonitor returns the monitor with the given ID from r's path, if it
+// belongs to acct.  Callers must hold s.mu.
+func findMonitor(acct *Account, r *http.Request) *Monitor {
+	id, err := strconv.Atoi(r.PathValue("monitor_id"))
+	if err != nil {
+		return nil
+	}
+	for _, m := range acct.Monitors {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+type deviceJSON struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Make     string                 `json:"make,omitempty"`
+	Model    string                 `json:"model,omitempty"`
+	Location string                 `json:"location,omitempty"`
+	Tags     map[string]interface{} `json:"tags"`
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.authorize(bearer(r))
+	if acct == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	m := findMonitor(acct, r)
+	if m == nil {
+		writeError(w, http.StatusNotFound, "Monitor not found")
+		return
+	}
+	devs := make([]deviceJSON, 0, len(m.Devices))
+	for _, d := range m.Devices {
+		devs = append(devs, deviceJSON{
+			ID:       d.ID,
+			Name:     d.Name,
+			Make:     d.Make,
+			Model:    d.Model,
+			Location: d.Location,
+			Tags:     map[string]interface{}{"UserDeviceType": d.Type},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"devices":              devs,
+		"device_data_checksum": randomString(),
+	})
+}
+
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	acct := s.authorize(r.URL.Query().Get("access_token"))
+	var m *Monitor
+	if acct != nil {
+		m = findMonitor(acct, r)
+	}
+	var (
+		msgs      []realtime.Message
+		interval  time.Duration
+		closeWhen bool
+	)
+	if m != nil {
+		msgs = append(msgs, m.Realtime...)
+		interval = m.RealtimeInterval
+		closeWhen = m.CloseRealtime
+	}
+	s.mu.Unlock()
+
+	if acct == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if m == nil {
+		writeError(w, http.StatusNotFound, "Monitor not found")
+		return
+	}
+
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	defer ws.CloseNow()
+	ctx := ws.CloseRead(r.Context())
+
+	for i, msg := range msgs {
+		if i > 0 && interval > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+		buf, err := encodeMessage(msg)
+		if err != nil {
+			ws.Close(websocket.StatusInternalError, err.Error())
+			return
+		}
+		if err := ws.Write(ctx, websocket.MessageText, buf); err != nil {
+			return
+		}
+	}
+	if closeWhen {
+		ws.Close(websocket.StatusNormalClosure, "")
+		return
+	}
+	<-ctx.Done()
+}
+
+// encodeMessage encodes msg in the form the real-time API uses.
+func encodeMessage(msg realtime.Message) ([]byte, error) {
+	buf, err := json.Marshal(struct {
+		Type    string           `json:"type"`
+		Payload realtime.Message `json:"payload"`
+	}{msg.GetType(), msg})
+	if err != nil {
+		return nil, fmt.Errorf("sensetest: encode %T: %w", msg, err)
+	}
+	return buf, nil
+}
@@ -0,0 +1,188 @@
+package sensetest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/realtime"
+	"github.com/dnesting/sense/senseauth"
+	"github.com/dnesting/sense/sensetest"
+)
+
+func newTestServer() *sensetest.Server {
+	return sensetest.NewServer(&sensetest.Account{
+		Email:     "test@example.com",
+		Password:  "pass",
+		UserID:    1,
+		AccountID: 2,
+		Monitors: []*sensetest.Monitor{{
+			ID:           123,
+			SerialNumber: "N123",
+			Devices: []sense.Device{
+				{ID: "abc", Name: "Fridge", Type: "Refrigerator"},
+			},
+			Realtime: []realtime.Message{
+				&realtime.Hello{Online: true},
+				&realtime.RealtimeUpdate{W: 590.4},
+			},
+		}},
+	})
+}
+
+func TestConnect(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.GetUserID() != 1 || client.GetAccountID() != 2 {
+		t.Errorf("expected user 1 account 2, got user %d account %d", client.GetUserID(), client.GetAccountID())
+	}
+	monitors := client.GetMonitors()
+	if len(monitors) != 1 || monitors[0].ID != 123 || monitors[0].SerialNumber != "N123" {
+		t.Fatalf("unexpected monitors: %+v", monitors)
+	}
+
+	devs, err := client.GetDevices(ctx, 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 1 || devs[0].Name != "Fridge" || devs[0].Type != "Refrigerator" {
+		t.Errorf("unexpected devices: %+v", devs)
+	}
+
+	var got []realtime.Message
+	err = client.Stream(ctx, 123, func(_ context.Context, msg realtime.Message) error {
+		got = append(got, msg)
+		if len(got) == 2 {
+			return realtime.Stop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := got[1].(*realtime.RealtimeUpdate); !ok || u.W != 590.4 {
+		t.Errorf("expected RealtimeUpdate with W=590.4, got %+v", got[1])
+	}
+}
+
+func TestBadPassword(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	_, err := sense.Connect(context.Background(), sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "wrong",
+	}, srv.Options()...)
+	if !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded, got %v", err)
+	}
+}
+
+func TestMFA(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		MfaCode:  "123456",
+		Monitors: []*sensetest.Monitor{{ID: 123}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+	creds := sense.PasswordCredentials{Email: "test@example.com", Password: "pass"}
+
+	if _, err := sense.Connect(ctx, creds, srv.Options()...); !errors.Is(err, senseauth.ErrMFANeeded) {
+		t.Errorf("expected ErrMFANeeded, got %v", err)
+	}
+
+	creds.MfaFn = func(context.Context) (string, error) { return "000000", nil }
+	if _, err := sense.Connect(ctx, creds, srv.Options()...); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded with wrong code, got %v", err)
+	}
+
+	creds.MfaFn = func(context.Context) (string, error) { return "123456", nil }
+	client, err := sense.Connect(ctx, creds, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.GetUserID() == 0 || client.GetAccountID() == 0 {
+		t.Errorf("expected user and account IDs after MFA, got %d and %d", client.GetUserID(), client.GetAccountID())
+	}
+	if ms := client.GetMonitors(); len(ms) != 1 || ms[0].ID != 123 {
+		t.Errorf("expected monitor 123 after MFA, got %+v", ms)
+	}
+
+	// The token should be renewable without MFA.
+	srv.ExpireTokens()
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Errorf("expected renewal after MFA login, got %v", err)
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, srv.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client doesn't know the token has expired, so it should retry
+	// after renewing it.
+	srv.ExpireTokens()
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Errorf("expected renewal after 401, got %v", err)
+	}
+}
+
+func Example() {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "you@example.com",
+		Password: "secret",
+		Monitors: []*sensetest.Monitor{{
+			ID: 123,
+			Realtime: []realtime.Message{
+				&realtime.Hello{Online: true},
+				&realtime.RealtimeUpdate{W: 590.4},
+			},
+		}},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "you@example.com",
+		Password: "secret",
+	}, srv.Options()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = client.Stream(ctx, 123, func(_ context.Context, msg realtime.Message) error {
+		if rt, ok := msg.(*realtime.RealtimeUpdate); ok {
+			fmt.Printf("Power consumption is now: %.1f W\n", rt.W)
+			return realtime.Stop
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Output:
+	// Power consumption is now: 590.4 W
+}
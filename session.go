@@ -0,0 +1,187 @@
+package sense
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Session holds everything needed to resume an authenticated [Client]
+// without the password.
+type Session struct {
+	// Email is the e-mail address used to authenticate, if known.
+	Email string
+
+	Token     *oauth2.Token
+	UserID    int
+	AccountID int
+	Monitors  []Monitor
+}
+
+// TokenStore persists a [Session] so that a [Client] can resume it later
+// (for instance after a process restarts) without going through password
+// authentication again, which may require MFA.
+//
+// Load returns a nil Session and no error if nothing has been stored.
+// Implementations should treat the Session as read-only.
+type TokenStore interface {
+	Load(ctx context.Context) (*Session, error)
+	Save(ctx context.Context, sess *Session) error
+	Clear(ctx context.Context) error
+}
+
+// FileTokenStore is a [TokenStore] that keeps a session in a JSON file.
+// The file contains credentials and is created with mode 0600.
+type FileTokenStore struct {
+	Path string
+
+	// Logger receives log records from loading the session.  If nil, a
+	// client created with [WithTokenStore] uses its own logger (see
+	// [WithLogger]).  Otherwise the logger set with [SetDebug] is used,
+	// if any.
+	Logger *slog.Logger
+}
+
+var _ TokenStore = (*FileTokenStore)(nil)
+
+// NewFileTokenStore returns a FileTokenStore that uses the file at path.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+// fileSession is the on-disk format of a FileTokenStore.
+type fileSession struct {
+	Email        string        `json:"email,omitempty"`
+	AccessToken  string        `json:"access_token"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	TokenType    string        `json:"token_type,omitempty"`
+	Expiry       time.Time     `json:"expiry,omitempty"`
+	UserID       int           `json:"user_id"`
+	AccountID    int           `json:"account_id"`
+	Monitors     []fileMonitor `json:"monitors,omitempty"`
+}
+
+type fileMonitor struct {
+	ID                int               `json:"id"`
+	SerialNumber      string            `json:"serial_number,omitempty"`
+	TimeZone          string            `json:"time_zone,omitempty"`
+	Online            bool              `json:"online,omitempty"`
+	SolarConnected    bool              `json:"solar_connected,omitempty"`
+	SolarConfigured   bool              `json:"solar_configured,omitempty"`
+	HardwareType      string            `json:"hardware_type,omitempty"`
+	EthernetSupported bool              `json:"ethernet_supported,omitempty"`
+	ZigbeeSupported   bool              `json:"zigbee_supported,omitempty"`
+	Attributes        MonitorAttributes `json:"attributes"`
+}
+
+// Load reads the session from the file.  If the file does not exist,
+// it returns nil.
+func (f *FileTokenStore) Load(_ context.Context) (*Session, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fs fileSession
+	if err := json.Unmarshal(data, &fs); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	sess := &Session{
+		Email: fs.Email,
+		Token: &oauth2.Token{
+			AccessToken:  fs.AccessToken,
+			RefreshToken: fs.RefreshToken,
+			TokenType:    fs.TokenType,
+			Expiry:       fs.Expiry,
+		},
+		UserID:    fs.UserID,
+		AccountID: fs.AccountID,
+	}
+	for _, m := range fs.Monitors {
+		sess.Monitors = append(sess.Monitors, Monitor{
+			ID:                m.ID,
+			SerialNumber:      m.SerialNumber,
+			TimeZone:          loadLocation(logger(f.Logger), m.TimeZone),
+			Online:            m.Online,
+			SolarConnected:    m.SolarConnected,
+			SolarConfigured:   m.SolarConfigured,
+			HardwareType:      m.HardwareType,
+			EthernetSupported: m.EthernetSupported,
+			ZigbeeSupported:   m.ZigbeeSupported,
+			Attributes:        m.Attributes,
+		})
+	}
+	return sess, nil
+}
+
+// Save writes the session to the file, replacing it atomically.
+func (f *FileTokenStore) Save(_ context.Context, sess *Session) error {
+	fs := fileSession{
+		Email:     sess.Email,
+		UserID:    sess.UserID,
+		AccountID: sess.AccountID,
+	}
+	if sess.Token != nil {
+		fs.AccessToken = sess.Token.AccessToken
+		fs.RefreshToken = sess.Token.RefreshToken
+		fs.TokenType = sess.Token.TokenType
+		fs.Expiry = sess.Token.Expiry
+	}
+	for _, m := range sess.Monitors {
+		fm := fileMonitor{
+			ID:                m.ID,
+			SerialNumber:      m.SerialNumber,
+			Online:            m.Online,
+			SolarConnected:    m.SolarConnected,
+			SolarConfigured:   m.SolarConfigured,
+			HardwareType:      m.HardwareType,
+			EthernetSupported: m.EthernetSupported,
+			ZigbeeSupported:   m.ZigbeeSupported,
+			Attributes:        m.Attributes,
+		}
+		if m.TimeZone != nil {
+			fm.TimeZone = m.TimeZone.String()
+		}
+		fs.Monitors = append(fs.Monitors, fm)
+	}
+	data, err := json.MarshalIndent(fs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), "."+filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// Clear removes the file.
+func (f *FileTokenStore) Clear(_ context.Context) error {
+	err := os.Remove(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
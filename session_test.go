@@ -0,0 +1,526 @@
+package sense_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/sensetest"
+	"golang.org/x/oauth2"
+)
+
+func newSessionTestServer() *sensetest.Server {
+	return sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 123, SerialNumber: "N123"}},
+	})
+}
+
+func TestFileTokenStore(t *testing.T) {
+	srv := newSessionTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(store.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+		}
+	}
+
+	// A new client should be able to resume without the password.
+	resumed, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email: "test@example.com",
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.GetUserID() != client.GetUserID() || resumed.GetAccountID() != client.GetAccountID() {
+		t.Errorf("expected resumed client to match original")
+	}
+	if m := resumed.GetMonitors(); len(m) != 1 || m[0].ID != 123 || m[0].SerialNumber != "N123" {
+		t.Errorf("unexpected monitors: %+v", m)
+	}
+	if _, err := resumed.GetDevices(ctx, 123, false); err != nil {
+		t.Error(err)
+	}
+
+	// A stored session for someone else should not be used.
+	if _, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email: "other@example.com",
+	}, opts...); err == nil {
+		t.Error("expected error authenticating as a different user")
+	}
+}
+
+func TestFileTokenStoreMFA(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		MfaCode:  "123456",
+		Monitors: []*sensetest.Monitor{{ID: 123}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+		MfaFn:    func(context.Context) (string, error) { return "123456", nil },
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.UserID == 0 || sess.UserID != client.GetUserID() {
+		t.Errorf("expected stored session for user %d, got %d", client.GetUserID(), sess.UserID)
+	}
+
+	// Resuming shouldn't need the MFA code again.
+	srv.ExpireTokens()
+	resumed, err := sense.Connect(ctx, sense.PasswordCredentials{Email: "test@example.com"}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resumed.GetDevices(ctx, 123, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileTokenStoreRenew(t *testing.T) {
+	srv := newSessionTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	if _, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expire the stored token so that resuming requires a renewal.
+	srv.ExpireTokens()
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := sess.Token.AccessToken
+	sess.Token.Expiry = time.Now().Add(-time.Minute)
+	if err := store.Save(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email: "test@example.com",
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Error(err)
+	}
+	sess, err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Token.AccessToken == oldToken {
+		t.Error("expected renewed token to be saved")
+	}
+}
+
+func TestFileTokenStoreFallback(t *testing.T) {
+	srv := newSessionTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	// A session that can't be renewed.
+	err := store.Save(ctx, &sense.Session{
+		Email:  "test@example.com",
+		Token:  &oauth2.Token{AccessToken: "bogus", RefreshToken: "bogus", Expiry: time.Now().Add(-time.Minute)},
+		UserID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetDevices(ctx, 123, false); err != nil {
+		t.Error(err)
+	}
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Token.AccessToken == "bogus" {
+		t.Error("expected new session to be saved")
+	}
+
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sess, err := store.Load(ctx); sess != nil || err != nil {
+		t.Errorf("expected no session after Clear, got %v, %v", sess, err)
+	}
+}
+
+func TestTokenCredentials(t *testing.T) {
+	srv := newSessionTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+
+	// Log in once with a password to obtain some tokens.
+	if _, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, append(srv.Options(), sense.WithTokenStore(store))...); err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		creds sense.TokenCredentials
+	}{
+		{"access", sense.TokenCredentials{
+			AccessToken:  sess.Token.AccessToken,
+			RefreshToken: sess.Token.RefreshToken,
+			UserID:       sess.UserID,
+		}},
+		{"refresh only", sense.TokenCredentials{
+			RefreshToken: sess.Token.RefreshToken,
+			UserID:       sess.UserID,
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := sense.Connect(ctx, tt.creds, srv.Options()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.GetUserID() != sess.UserID || client.GetAccountID() != sess.AccountID {
+				t.Errorf("expected user %d account %d, got user %d account %d",
+					sess.UserID, sess.AccountID, client.GetUserID(), client.GetAccountID())
+			}
+			if m := client.GetMonitors(); len(m) != 1 || m[0].ID != 123 || m[0].SerialNumber != "N123" {
+				t.Errorf("unexpected monitors: %+v", m)
+			}
+			if _, err := client.GetDevices(ctx, 123, false); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if _, err := sense.Connect(ctx, &sense.TokenCredentials{
+		RefreshToken: "bogus",
+		UserID:       sess.UserID,
+	}, srv.Options()...); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded with a bad refresh token, got %v", err)
+	}
+	if _, err := sense.Connect(ctx, sense.TokenCredentials{
+		RefreshToken: sess.Token.RefreshToken,
+	}, srv.Options()...); err == nil {
+		t.Error("expected error without a user ID")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	srv := newSessionTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, append(srv.Options(), sense.WithTokenStore(store))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.GetUserID() != 0 || client.GetAccountID() != 0 || client.GetMonitors() != nil {
+		t.Error("expected client to be unauthenticated after Logout")
+	}
+	if _, err := client.GetDevices(ctx, 123, false); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded after Logout, got %v", err)
+	}
+	if sess, err := store.Load(ctx); sess != nil || err != nil {
+		t.Errorf("expected stored session to be cleared, got %v, %v", sess, err)
+	}
+
+	// The old tokens should no longer work.
+	if _, err := sense.Connect(ctx, sense.TokenCredentials{
+		AccessToken:  sess.Token.AccessToken,
+		RefreshToken: sess.Token.RefreshToken,
+		UserID:       sess.UserID,
+	}, srv.Options()...); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded with revoked tokens, got %v", err)
+	}
+
+	// Logging out again is harmless.
+	if err := client.Logout(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMonitorMetadata(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{
+			ID:              123,
+			SerialNumber:    "N123",
+			TimeZone:        "America/New_York",
+			Online:          true,
+			SolarConnected:  true,
+			SolarConfigured: true,
+			HardwareType:    "monitor",
+			Attributes: sense.MonitorAttributes{
+				Cost:         13.4,
+				SellBackRate: 5.5,
+				TOUEnabled:   true,
+				PostalCode:   "02134",
+			},
+		}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	check := func(t *testing.T, client *sense.Client) {
+		t.Helper()
+		ms := client.GetMonitors()
+		if len(ms) != 1 {
+			t.Fatalf("expected 1 monitor, got %d", len(ms))
+		}
+		m := ms[0]
+		if m.TimeZone == nil || m.TimeZone.String() != "America/New_York" {
+			t.Errorf("expected time zone America/New_York, got %v", m.TimeZone)
+		}
+		if !m.Online || !m.SolarConnected || !m.SolarConfigured || m.HardwareType != "monitor" {
+			t.Errorf("unexpected monitor details: %+v", m)
+		}
+		a := m.Attributes
+		if a.Cost != 13.4 || a.SellBackRate != 5.5 || !a.TOUEnabled || a.PostalCode != "02134" {
+			t.Errorf("unexpected monitor attributes: %+v", a)
+		}
+	}
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, client)
+
+	// The details should survive being stored.
+	resumed, err := sense.Connect(ctx, sense.PasswordCredentials{Email: "test@example.com"}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, resumed)
+
+	if got := client.GetMonitors()[0].Attributes.Cost.String(); got != "13.4¢/kWh" {
+		t.Errorf("expected 13.4¢/kWh, got %s", got)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	acct := &sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 123}, {ID: 456}},
+	}
+	srv := sensetest.NewServer(acct)
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, append(srv.Options(), sense.WithTokenStore(store))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Lock()
+	acct.Monitors = []*sensetest.Monitor{{ID: 456}, {ID: 789, SerialNumber: "N789"}}
+	srv.Unlock()
+
+	added, removed, err := client.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].ID != 789 || added[0].SerialNumber != "N789" {
+		t.Errorf("expected monitor 789 to be added, got %+v", added)
+	}
+	if len(removed) != 1 || removed[0].ID != 123 {
+		t.Errorf("expected monitor 123 to be removed, got %+v", removed)
+	}
+	if ms := client.GetMonitors(); len(ms) != 2 || ms[0].ID != 456 || ms[1].ID != 789 {
+		t.Errorf("unexpected monitors after refresh: %+v", ms)
+	}
+
+	sess, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sess.Monitors) != 2 || sess.Monitors[1].ID != 789 {
+		t.Errorf("expected refreshed monitors to be saved, got %+v", sess.Monitors)
+	}
+
+	// Nothing changed since the last refresh.
+	if added, removed, err := client.Refresh(ctx); err != nil || added != nil || removed != nil {
+		t.Errorf("expected no changes, got %+v, %+v, %v", added, removed, err)
+	}
+
+	if _, _, err := sense.New(srv.Options()...).Refresh(ctx); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded for unauthenticated client, got %v", err)
+	}
+}
+
+// hookTransport calls before ahead of each request it sends.
+type hookTransport struct {
+	before func(req *http.Request)
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.before(req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRefreshUserChanged(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "first@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 123}},
+	}, &sensetest.Account{
+		Email:    "second@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 456}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+
+	var client *sense.Client
+	var armed atomic.Bool
+	hook := &hookTransport{before: func(req *http.Request) {
+		// Switch users while Refresh is fetching the first one.
+		if req.Method == http.MethodGet && strings.Contains(req.URL.Path, "/users/") && armed.CompareAndSwap(true, false) {
+			if err := client.Authenticate(ctx, sense.PasswordCredentials{
+				Email:    "second@example.com",
+				Password: "pass",
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+	}}
+	client, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "first@example.com",
+		Password: "pass",
+	}, append(srv.Options(), sense.WithHttpClient(&http.Client{Transport: hook}))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	armed.Store(true)
+	if _, _, err := client.Refresh(ctx); err == nil || !strings.Contains(err.Error(), "user changed") {
+		t.Errorf("expected error when the user changes during refresh, got %v", err)
+	}
+	if ms := client.GetMonitors(); len(ms) != 1 || ms[0].ID != 456 {
+		t.Errorf("expected the second user's monitors to remain, got %+v", ms)
+	}
+}
+
+func TestFileTokenStoreLogger(t *testing.T) {
+	srv := sensetest.NewServer(&sensetest.Account{
+		Email:    "test@example.com",
+		Password: "pass",
+		Monitors: []*sensetest.Monitor{{ID: 123, TimeZone: "America/New_York"}},
+	})
+	defer srv.Close()
+	ctx := context.Background()
+	store := sense.NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	opts := append(srv.Options(), sense.WithTokenStore(store))
+
+	if _, err := sense.Connect(ctx, sense.PasswordCredentials{
+		Email:    "test@example.com",
+		Password: "pass",
+	}, opts...); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the stored time zone.
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "America/New_York", "Not/A_Zone", 1))
+	if err := os.WriteFile(store.Path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the stored session should log to the resuming client's logger.
+	var logged syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, err := sense.Connect(ctx, sense.PasswordCredentials{Email: "test@example.com"},
+		append(opts, sense.WithLogger(logger))...); err != nil {
+		t.Fatal(err)
+	}
+	if got := logged.String(); !strings.Contains(got, "unable to load time zone") || !strings.Contains(got, "resumed stored session") {
+		t.Errorf("expected stored time zone error to be logged, got:\n%s", got)
+	}
+	if store.Logger != nil {
+		t.Error("expected the caller's store to be left alone")
+	}
+}
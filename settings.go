@@ -0,0 +1,171 @@
+package sense
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/dnesting/sense/internal/client"
+	"go.opentelemetry.io/otel"
+)
+
+// UserSettings holds the account-wide settings for the user.
+type UserSettings struct {
+	// Version is incremented by Sense each time the settings change.
+	Version int
+
+	LabsEnabled bool
+
+	// Notifications holds the notification settings for each monitor,
+	// keyed by monitor ID.
+	Notifications map[int]NotificationSettings
+
+	TOTPEnabled bool
+	DateCreated time.Time
+	ABCohort    string
+}
+
+// NotificationSettings controls which push and e-mail notifications the
+// user receives about a monitor.
+type NotificationSettings struct {
+	NewNamedDevicePush       bool
+	NewNamedDeviceEmail      bool
+	MonitorOfflinePush       bool
+	MonitorOfflineEmail      bool
+	MonitorMonthlyEmail      bool
+	AlwaysOnChangePush       bool
+	ComparisonChangePush     bool
+	NewPeakPush              bool
+	NewPeakEmail             bool
+	MonthlyChangePush        bool
+	WeeklyChangePush         bool
+	DailyChangePush          bool
+	GeneratorOnPush          bool
+	GeneratorOffPush         bool
+	TimeOfUse                bool
+	GridOutagePush           bool
+	GridRestoredPush         bool
+	RelayUpdateAvailablePush bool
+	RelayUpdateInstalledPush bool
+}
+
+func notificationSettingsFromClient(n client.NotificationSettings) NotificationSettings {
+	return NotificationSettings{
+		NewNamedDevicePush:       deref(n.NewNamedDevicePush),
+		NewNamedDeviceEmail:      deref(n.NewNamedDeviceEmail),
+		MonitorOfflinePush:       deref(n.MonitorOfflinePush),
+		MonitorOfflineEmail:      deref(n.MonitorOfflineEmail),
+		MonitorMonthlyEmail:      deref(n.MonitorMonthlyEmail),
+		AlwaysOnChangePush:       deref(n.AlwaysOnChangePush),
+		ComparisonChangePush:     deref(n.ComparisonChangePush),
+		NewPeakPush:              deref(n.NewPeakPush),
+		NewPeakEmail:             deref(n.NewPeakEmail),
+		MonthlyChangePush:        deref(n.MonthlyChangePush),
+		WeeklyChangePush:         deref(n.WeeklyChangePush),
+		DailyChangePush:          deref(n.DailyChangePush),
+		GeneratorOnPush:          deref(n.GeneratorOnPush),
+		GeneratorOffPush:         deref(n.GeneratorOffPush),
+		TimeOfUse:                deref(n.TimeOfUse),
+		GridOutagePush:           deref(n.GridOutagePush),
+		GridRestoredPush:         deref(n.GridRestoredPush),
+		RelayUpdateAvailablePush: deref(n.RelayUpdateAvailablePush),
+		RelayUpdateInstalledPush: deref(n.RelayUpdateInstalledPush),
+	}
+}
+
+func (n NotificationSettings) toClient() client.NotificationSettings {
+	return client.NotificationSettings{
+		NewNamedDevicePush:       &n.NewNamedDevicePush,
+		NewNamedDeviceEmail:      &n.NewNamedDeviceEmail,
+		MonitorOfflinePush:       &n.MonitorOfflinePush,
+		MonitorOfflineEmail:      &n.MonitorOfflineEmail,
+		MonitorMonthlyEmail:      &n.MonitorMonthlyEmail,
+		AlwaysOnChangePush:       &n.AlwaysOnChangePush,
+		ComparisonChangePush:     &n.ComparisonChangePush,
+		NewPeakPush:              &n.NewPeakPush,
+		NewPeakEmail:             &n.NewPeakEmail,
+		MonthlyChangePush:        &n.MonthlyChangePush,
+		WeeklyChangePush:         &n.WeeklyChangePush,
+		DailyChangePush:          &n.DailyChangePush,
+		GeneratorOnPush:          &n.GeneratorOnPush,
+		GeneratorOffPush:         &n.GeneratorOffPush,
+		TimeOfUse:                &n.TimeOfUse,
+		GridOutagePush:           &n.GridOutagePush,
+		GridRestoredPush:         &n.GridRestoredPush,
+		RelayUpdateAvailablePush: &n.RelayUpdateAvailablePush,
+		RelayUpdateInstalledPush: &n.RelayUpdateInstalledPush,
+	}
+}
+
+// userSettingsFromClient converts the settings in a client.UserSettings,
+// which uses strings for the monitor IDs.
+func userSettingsFromClient(log *slog.Logger, us *client.UserSettings) (out UserSettings) {
+	if us == nil {
+		return
+	}
+	out.Version = deref(us.Version)
+	if us.Settings != nil {
+		out.LabsEnabled = deref(us.Settings.LabsEnabled)
+		for id, n := range deref(us.Settings.Notifications) {
+			monitorID, err := strconv.Atoi(id)
+			if err != nil {
+				log.Debug("sense: ignoring notification settings", slog.String("monitor_id", id))
+				continue
+			}
+			if out.Notifications == nil {
+				out.Notifications = make(map[int]NotificationSettings)
+			}
+			out.Notifications[monitorID] = notificationSettingsFromClient(n)
+		}
+	}
+	return
+}
+
+// GetUserSettings returns the current settings for the user.
+func (s *Client) GetUserSettings(ctx context.Context) (*UserSettings, error) {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "GetUserSettings")
+	defer span.End()
+
+	st := s.current()
+	userID := st.userID()
+	if userID == 0 {
+		return nil, fmt.Errorf("sense: get user settings: %w", ErrAuthenticationNeeded)
+	}
+	res, err1 := st.client.GetUserWithResponse(ctx, userID)
+	if err := client.Ensure(err1, "GetUser", res, 200); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	hello := res.JSON200
+	settings := userSettingsFromClient(s.log(), hello.Settings)
+	settings.TOTPEnabled = deref(hello.TotpEnabled)
+	settings.DateCreated = deref(hello.DateCreated)
+	settings.ABCohort = deref(hello.AbCohort)
+	return &settings, nil
+}
+
+// UpdateNotificationSettings replaces the notification settings for the
+// given monitor.  To change only some settings, first retrieve the current
+// ones with [Client.GetUserSettings].
+func (s *Client) UpdateNotificationSettings(ctx context.Context, monitorID int, settings NotificationSettings) error {
+	ctx, span := otel.Tracer(traceName).Start(ctx, "UpdateNotificationSettings")
+	defer span.End()
+
+	st := s.current()
+	userID := st.userID()
+	if userID == 0 {
+		return fmt.Errorf("sense: update notification settings: %w", ErrAuthenticationNeeded)
+	}
+	res, err1 := st.client.UpdateNotificationSettingsWithResponse(
+		ctx,
+		userID,
+		&client.UpdateNotificationSettingsParams{MonitorId: monitorID},
+		settings.toClient())
+	if err := client.Ensure(err1, "UpdateNotificationSettings", res, 200); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
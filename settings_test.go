@@ -0,0 +1,62 @@
+package sense_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dnesting/sense"
+	"github.com/dnesting/sense/sensetest"
+)
+
+func TestUserSettings(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := connectTestClient(t, srv)
+
+	settings, err := client.GetUserSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.DateCreated.Equal(testDateCreated) || settings.TOTPEnabled || len(settings.Notifications) != 0 {
+		t.Errorf("unexpected settings: %+v", settings)
+	}
+
+	want := sense.NotificationSettings{
+		MonitorOfflinePush: true,
+		GridOutagePush:     true,
+		GridRestoredPush:   true,
+	}
+	if err := client.UpdateNotificationSettings(ctx, 123, want); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := client.GetUserSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version <= settings.Version {
+		t.Errorf("expected version to increase from %d, got %d", settings.Version, updated.Version)
+	}
+	if got := updated.Notifications[123]; got != want {
+		t.Errorf("expected notification settings %+v, got %+v", want, got)
+	}
+
+	if err := client.UpdateNotificationSettings(ctx, 456, want); err == nil {
+		t.Error("expected error updating an unknown monitor")
+	}
+}
+
+func TestUserSettingsUnauthenticated(t *testing.T) {
+	srv := sensetest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := sense.New(srv.Options()...)
+	if _, err := client.GetUserSettings(ctx); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded from GetUserSettings, got %v", err)
+	}
+	if err := client.UpdateNotificationSettings(ctx, 123, sense.NotificationSettings{}); !errors.Is(err, sense.ErrAuthenticationNeeded) {
+		t.Errorf("expected ErrAuthenticationNeeded from UpdateNotificationSettings, got %v", err)
+	}
+}
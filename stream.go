@@ -2,6 +2,10 @@ package sense
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 
 	"github.com/dnesting/sense/realtime"
 	"golang.org/x/oauth2"
@@ -14,9 +18,110 @@ const (
 
 // Stream begins streaming real-time data via callback.  If the callback returns
 // realtime.Stop, the stream will be closed and this function will return without error.
-// Otherwise, if any other error occurs, it will be returned.
+// If ctx is cancelled, ctx.Err() is returned.  Otherwise, if any other error
+// occurs, it will be returned.
+//
+// If the client was created with [WithReconnect], the stream will be
+// re-established when the connection fails.
 func (s *Client) Stream(ctx context.Context, monitor int, callback realtime.Callback) error {
-	return s.realtimeClient.Stream(ctx, monitor, callback)
+	return s.current().realtimeClient.Stream(ctx, monitor, callback)
+}
+
+// MonitorCallback is called for each message received during a
+// [Client.StreamAll] call, along with the ID of the monitor it came from.
+type MonitorCallback func(ctx context.Context, monitorID int, msg realtime.Message) error
+
+// MonitorError describes the failure of one monitor's stream during
+// [Client.StreamAll].
+type MonitorError struct {
+	MonitorID int
+	Err       error
+}
+
+func (e *MonitorError) Error() string {
+	return fmt.Sprintf("monitor %d: %v", e.MonitorID, e.Err)
+}
+
+func (e *MonitorError) Unwrap() error {
+	return e.Err
+}
+
+// StreamAll streams real-time data from every monitor returned by
+// [Client.GetMonitors] at once, using one connection per monitor, and
+// delivers all of their messages to callback.  Calls to callback are
+// serialized, so it does not need to be safe for concurrent use.
+//
+// If one monitor's stream fails, the others continue.  Once all of them
+// have ended, StreamAll returns the failures joined together, each as a
+// [*MonitorError].  If the client was created with [WithReconnect], each
+// monitor reconnects independently.
+//
+// If callback returns realtime.Stop, all streams are closed and StreamAll
+// returns nil.  If it returns any other error, all streams are closed and
+// that error is returned.
+func (s *Client) StreamAll(ctx context.Context, callback MonitorCallback) error {
+	monitors := s.GetMonitors()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex // serializes callbacks
+		stopped bool
+		cbErr   error
+		wg      sync.WaitGroup
+	)
+	errs := make([]error, len(monitors))
+	for i, m := range monitors {
+		wg.Add(1)
+		go func(i, monitorID int) {
+			defer wg.Done()
+			err := s.Stream(ctx, monitorID, func(ctx context.Context, msg realtime.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if stopped {
+					return realtime.Stop
+				}
+				if err := callback(ctx, monitorID, msg); err != nil {
+					stopped = true
+					if err != realtime.Stop {
+						cbErr = err
+					}
+					cancel()
+					return realtime.Stop
+				}
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				s.log().Debug("sense: stream failed",
+					slog.Int("monitor_id", monitorID),
+					slog.Any("error", err))
+				errs[i] = &MonitorError{MonitorID: monitorID, Err: err}
+			}
+		}(i, m.ID)
+	}
+	wg.Wait()
+
+	if cbErr != nil {
+		return cbErr
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe begins streaming real-time data from the given monitor and
+// returns a [realtime.Subscription] that delivers messages over a channel.
+// This is an alternative to [Client.Stream] for callers that want to select
+// on the feed alongside other channels.  If opts is nil, defaults are used.
+//
+//	sub := client.Subscribe(ctx, monitorID, nil)
+//	defer sub.Close()
+//	for msg := range sub.C {
+//		...
+//	}
+//	if err := sub.Err(); err != nil {
+//		...
+//	}
+func (s *Client) Subscribe(ctx context.Context, monitor int, opts *realtime.SubscribeOptions) *realtime.Subscription {
+	return realtime.Subscribe(ctx, s.current().realtimeClient, monitor, opts)
 }
 
 // Deprecated: For use with testing.
@@ -30,11 +135,14 @@ func newRealtimeClient(opts *newOptions, src oauth2.TokenSource) internalRealtim
 		return opts.internalRealtimeClient
 	}
 	c := &realtime.Client{
-		HttpClient: opts.httpClient,
-		BaseUrl:    opts.realtimeApiUrl,
-		DeviceID:   opts.deviceID,
-		Origin:     opts.realtimeOrigin,
-		TokenSrc:   src,
+		HttpClient:  opts.httpClient,
+		BaseUrl:     opts.realtimeApiUrl,
+		DeviceID:    opts.deviceID,
+		Origin:      opts.realtimeOrigin,
+		TokenSrc:    src,
+		Reconnect:   opts.reconnect,
+		IdleTimeout: opts.idleTimeout,
+		Logger:      opts.logger,
 	}
 	if c.Origin == "" {
 		c.Origin = defaultRealtimeOrigin
@@ -2,6 +2,7 @@ package sense_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -85,3 +86,112 @@ func ExampleClient_Stream() {
 	// Power consumption is now: 591.4 W
 	// Power consumption is now: 592.4 W
 }
+
+func ExampleClient_Subscribe() {
+	// instantiate a Sense client (error checking omitted)
+	client, _ := sense.Connect(
+		context.Background(),
+		sense.PasswordCredentials{
+			Email:    "test@example.com",
+			Password: "pass",
+		},
+		mockForExample()...)
+
+	// subscribe to a monitor and collect 3 data points
+	sub := client.Subscribe(context.Background(), 123, nil)
+	defer sub.Close()
+
+	stopAfter := 3
+	for msg := range sub.C {
+		if msg, ok := msg.(*realtime.RealtimeUpdate); ok {
+			fmt.Printf("Power consumption is now: %.1f W\n", msg.W)
+			stopAfter--
+			if stopAfter == 0 {
+				break
+			}
+		}
+	}
+
+	// Output:
+	// Power consumption is now: 590.4 W
+	// Power consumption is now: 591.4 W
+	// Power consumption is now: 592.4 W
+}
+
+// monitorRTClient is a mock realtime client that streams from a
+// different channel for each monitor.
+type monitorRTClient map[int]chan senseutil.RTMsg
+
+func (m monitorRTClient) Stream(ctx context.Context, monitorID int, f realtime.Callback) error {
+	return (&senseutil.MockRTClient{Ch: m[monitorID]}).Stream(ctx, monitorID, f)
+}
+
+func connectWithMonitors(t *testing.T, rt monitorRTClient) *sense.Client {
+	t.Helper()
+	client, err := sense.Connect(
+		context.Background(),
+		sense.PasswordCredentials{Email: "test@example.com", Password: "pass"},
+		sense.WithInternalClient(nil, rt),
+		sense.WithHttpClient(&http.Client{
+			Transport: &senseutil.MockTransport{
+				RT: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": []string{"application/json"}},
+						Body:       io.NopCloser(strings.NewReader(`{"access_token":"fake-token","monitors":[{"id":1},{"id":2}]}`)),
+					}, nil
+				},
+			},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestStreamAll(t *testing.T) {
+	errDown := errors.New("monitor down")
+	rt := monitorRTClient{
+		1: make(chan senseutil.RTMsg, 3),
+		2: make(chan senseutil.RTMsg, 3),
+	}
+	rt[1] <- senseutil.RTMsg{M: &realtime.RealtimeUpdate{W: 1}}
+	rt[1] <- senseutil.RTMsg{E: errDown}
+	rt[2] <- senseutil.RTMsg{M: &realtime.RealtimeUpdate{W: 2}}
+	rt[2] <- senseutil.RTMsg{M: &realtime.RealtimeUpdate{W: 2}}
+	close(rt[2])
+	client := connectWithMonitors(t, rt)
+
+	got := map[int]int{}
+	err := client.StreamAll(context.Background(), func(_ context.Context, monitorID int, msg realtime.Message) error {
+		if u, ok := msg.(*realtime.RealtimeUpdate); ok && int(u.W) != monitorID {
+			t.Errorf("message for monitor %d tagged with %d", int(u.W), monitorID)
+		}
+		got[monitorID]++
+		return nil
+	})
+	if got[1] != 1 || got[2] != 2 {
+		t.Errorf("expected 1 message from monitor 1 and 2 from monitor 2, got %v", got)
+	}
+	var merr *sense.MonitorError
+	if !errors.As(err, &merr) || merr.MonitorID != 1 || !errors.Is(err, errDown) {
+		t.Errorf("expected MonitorError for monitor 1, got %v", err)
+	}
+}
+
+func TestStreamAllStop(t *testing.T) {
+	rt := monitorRTClient{
+		1: make(chan senseutil.RTMsg), // never sends
+		2: make(chan senseutil.RTMsg, 1),
+	}
+	rt[2] <- senseutil.RTMsg{M: &realtime.Hello{}}
+	client := connectWithMonitors(t, rt)
+
+	errBoom := errors.New("boom")
+	err := client.StreamAll(context.Background(), func(_ context.Context, monitorID int, msg realtime.Message) error {
+		return errBoom
+	})
+	if err != errBoom {
+		t.Errorf("expected %v, got %v", errBoom, err)
+	}
+}